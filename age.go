@@ -0,0 +1,51 @@
+package clip
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ParseAge parses ages like `90d`, `2w` or `1y` along with anything time.ParseDuration()
+// accepts. A day is 24 hours and a year is 365 days.
+func ParseAge(age string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+		"y": 365 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if !strings.HasSuffix(age, suffix) {
+			continue
+		}
+		count, err := strconv.Atoi(strings.TrimSuffix(age, suffix))
+		if err != nil || count < 0 {
+			return 0, errors.Errorf("invalid age '%s'; expected a number of days like '90d'", age)
+		}
+		return time.Duration(count) * unit, nil
+	}
+
+	duration, err := time.ParseDuration(age)
+	if err != nil || duration < 0 {
+		return 0, errors.Errorf("invalid age '%s'; expected a number of days like '90d'", age)
+	}
+	return duration, nil
+}
+
+// FormatAge formats 'age' as a short age like `3d`, `5w` or `2y` in the largest whole unit
+func FormatAge(age time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case age >= 365*day:
+		return strconv.Itoa(int(age/(365*day))) + "y"
+	case age >= 7*day:
+		return strconv.Itoa(int(age/(7*day))) + "w"
+	case age >= day:
+		return strconv.Itoa(int(age/day)) + "d"
+	case age >= time.Hour:
+		return strconv.Itoa(int(age/time.Hour)) + "h"
+	}
+	return strconv.Itoa(int(age/time.Minute)) + "m"
+}
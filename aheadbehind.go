@@ -0,0 +1,344 @@
+package clip
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AheadBehind counts the commits a branch has that its base does not (Ahead) and the
+// commits the base has that the branch does not (Behind)
+type AheadBehind struct {
+	Ahead  int
+	Behind int
+}
+
+// RevPair is a branch sha and the base sha it's compared against
+type RevPair struct {
+	Branch string
+	Base   string
+}
+
+type AheadBehindMap map[RevPair]AheadBehind
+
+func (b *ExecBackend) AheadBehind(result AheadBehindMap, pairs []RevPair) error {
+	tips := uniqueTips(pairs)
+	if len(tips) < 2 {
+		return walkAheadBehind(result, pairs, graphSource{})
+	}
+
+	// Commits reachable from the common ancestors of every tip are reachable from
+	// all the tips and can't change any of the counts, so only walk above them.
+	var output string
+	if err := b.git(&output, append([]string{"merge-base", "--octopus"}, tips...)...); err != nil {
+		// `git merge-base` exits with 1 if the tips share no history
+		if !isExitCode(err, 1) {
+			return errors.Wrap(err, "AheadBehind()")
+		}
+	}
+	input := strings.Join(tips, "\n") + "\n"
+	for _, base := range strings.Fields(output) {
+		input += "^" + base + "\n"
+	}
+
+	if err := b.gitInput(&output, input, "rev-list", "--topo-order", "--parents", "--stdin"); err != nil {
+		return errors.Wrap(err, "AheadBehind()")
+	}
+	return walkAheadBehind(result, pairs, parseRevListParents(output))
+}
+
+func (r *Repository) AheadBehind(result AheadBehindMap, pairs []RevPair) error {
+	return r.Backend.AheadBehind(result, pairs)
+}
+
+// parseRevListParents parses the output of `git rev-list --topo-order --parents` into a
+// graphSource where the order of each commit reflects its position in the output
+func parseRevListParents(input string) graphSource {
+	lines := strings.Split(strings.TrimSpace(input), "\n")
+	source := graphSource{}
+	for idx, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		source[fields[0]] = graphCommit{parents: fields[1:], order: int64(len(lines) - idx)}
+	}
+	return source
+}
+
+// commitSource provides the commit graph to walkAheadBehind()
+type commitSource interface {
+	// parents returns the parents of 'sha' and its order in the walk. Commits with a higher
+	// order are walked first, ideally a commit is ordered below all of its children.
+	// Commits unknown to the source are returned with 'ok' false and are not walked.
+	parents(sha string) (parents []string, order int64, ok bool, err error)
+}
+
+type graphCommit struct {
+	parents []string
+	order   int64
+}
+
+// graphSource is a commitSource for a graph which has already been loaded into memory
+type graphSource map[string]graphCommit
+
+func (g graphSource) parents(sha string) ([]string, int64, bool, error) {
+	commit, ok := g[sha]
+	return commit.parents, commit.order, ok, nil
+}
+
+func uniqueTips(pairs []RevPair) []string {
+	var tips []string
+	seen := map[string]bool{}
+	for _, pair := range pairs {
+		for _, sha := range []string{pair.Branch, pair.Base} {
+			if sha != "" && !seen[sha] {
+				seen[sha] = true
+				tips = append(tips, sha)
+			}
+		}
+	}
+	return tips
+}
+
+// walkAheadBehind counts ahead and behind for every pair in one walk of the commit graph
+func walkAheadBehind(result AheadBehindMap, pairs []RevPair, source commitSource) error {
+	tips := uniqueTips(pairs)
+	index := map[string]int{}
+	for i, tip := range tips {
+		index[tip] = i
+	}
+	paint, err := paintTips(tips, source)
+	if err != nil {
+		return err
+	}
+
+	// Many commits share the same paint, count each distinct set once
+	counts := map[string]int{}
+	sets := map[string]bitset{}
+	for _, bits := range paint {
+		key := bits.key()
+		counts[key]++
+		sets[key] = bits
+	}
+
+	for _, pair := range pairs {
+		if pair.Branch == pair.Base || pair.Branch == "" || pair.Base == "" {
+			result[pair] = AheadBehind{}
+			continue
+		}
+		branch, base := index[pair.Branch], index[pair.Base]
+		var count AheadBehind
+		for key, bits := range sets {
+			hasBranch, hasBase := bits.has(branch), bits.has(base)
+			if hasBranch && !hasBase {
+				count.Ahead += counts[key]
+			}
+			if hasBase && !hasBranch {
+				count.Behind += counts[key]
+			}
+		}
+		result[pair] = count
+	}
+	return nil
+}
+
+// paintTips paints each commit with the set of 'tips' it is reachable from. Paint flows from
+// children to parents and the walk stops descending once every queued commit is reachable
+// from all of the tips, since those commits can't tell the tips apart.
+func paintTips(tips []string, source commitSource) (map[string]bitset, error) {
+	full := newBitset(len(tips))
+	for i := range tips {
+		full.set(i)
+	}
+
+	paint := map[string]bitset{}
+	walked := map[string]bitset{}
+	queue := &walkQueue{queued: map[string]*walkEntry{}}
+
+	for i, tip := range tips {
+		_, order, ok, err := source.parents(tip)
+		if err != nil {
+			return nil, err
+		}
+		// Commits unknown to the source are reachable from every tip
+		if !ok {
+			continue
+		}
+		bits, exists := paint[tip]
+		if !exists {
+			bits = newBitset(len(tips))
+			paint[tip] = bits
+		}
+		bits.set(i)
+		queue.add(tip, order, true)
+	}
+
+	for queue.Len() > 0 {
+		entry := heap.Pop(queue).(*walkEntry)
+		delete(queue.queued, entry.sha)
+		if err := walkParents(entry, paint, walked, full, queue, source); err != nil {
+			return nil, err
+		}
+		if entry.counted {
+			queue.pending--
+		}
+	}
+	return paint, nil
+}
+
+// walkParents passes the paint of 'entry' on to its parents, queueing any parent whose
+// paint changed
+func walkParents(entry *walkEntry, paint, walked map[string]bitset, full bitset,
+	queue *walkQueue, source commitSource) error {
+
+	bits := paint[entry.sha]
+	// Already walked with the same paint; nothing new to pass on to the parents
+	if prev, ok := walked[entry.sha]; ok && prev.equal(bits) {
+		return nil
+	}
+	walked[entry.sha] = bits.clone()
+
+	parents, _, _, err := source.parents(entry.sha)
+	if err != nil {
+		return err
+	}
+	for _, parent := range parents {
+		_, order, known, err := source.parents(parent)
+		if err != nil {
+			return err
+		}
+		if !known {
+			continue
+		}
+		existing, ok := paint[parent]
+		if !ok {
+			// Every queued commit is reachable from all the tips, so only commits already
+			// painted by a walk that got ahead of its children need the paint passed on
+			if queue.pending == 0 {
+				continue
+			}
+			existing = make(bitset, len(full))
+		}
+		if !existing.merge(bits) && ok {
+			continue
+		}
+		paint[parent] = existing
+		queue.add(parent, order, !existing.equal(full))
+	}
+	return nil
+}
+
+type bitset []uint64
+
+func newBitset(size int) bitset {
+	return make(bitset, (size+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << uint(i%64)
+}
+
+func (b bitset) has(i int) bool {
+	return b[i/64]&(1<<uint(i%64)) != 0
+}
+
+// merge ors 'other' into 'b' and returns true if 'b' changed
+func (b bitset) merge(other bitset) bool {
+	changed := false
+	for i := range b {
+		if b[i]|other[i] != b[i] {
+			b[i] |= other[i]
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (b bitset) equal(other bitset) bool {
+	for i := range b {
+		if b[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b bitset) clone() bitset {
+	return append(bitset(nil), b...)
+}
+
+func (b bitset) key() string {
+	var buf strings.Builder
+	for _, word := range b {
+		for i := uint(0); i < 64; i += 8 {
+			buf.WriteByte(byte(word >> i))
+		}
+	}
+	return buf.String()
+}
+
+type walkEntry struct {
+	sha     string
+	order   int64
+	counted bool
+}
+
+// walkQueue is a priority queue of commits ordered highest order first. 'pending' counts
+// the queued commits which were not reachable from every tip when queued.
+type walkQueue struct {
+	entries []*walkEntry
+	queued  map[string]*walkEntry
+	pending int
+}
+
+// add queues 'sha' unless it is already queued
+func (q *walkQueue) add(sha string, order int64, counted bool) {
+	if entry, ok := q.queued[sha]; ok {
+		if counted && !entry.counted {
+			entry.counted = true
+			q.pending++
+		}
+		return
+	}
+	entry := &walkEntry{sha: sha, order: order, counted: counted}
+	q.queued[sha] = entry
+	if counted {
+		q.pending++
+	}
+	heap.Push(q, entry)
+}
+
+func (q *walkQueue) Len() int           { return len(q.entries) }
+func (q *walkQueue) Less(i, j int) bool { return q.entries[i].order > q.entries[j].order }
+func (q *walkQueue) Swap(i, j int)      { q.entries[i], q.entries[j] = q.entries[j], q.entries[i] }
+func (q *walkQueue) Push(x interface{}) { q.entries = append(q.entries, x.(*walkEntry)) }
+func (q *walkQueue) Pop() interface{} {
+	last := q.entries[len(q.entries)-1]
+	q.entries = q.entries[:len(q.entries)-1]
+	return last
+}
+
+// walkCommitsBetween finds the commits reachable from 'end' but not from 'begin', newest first
+func walkCommitsBetween(commits *[]string, begin, end string, source commitSource) error {
+	paint, err := paintTips([]string{end, begin}, source)
+	if err != nil {
+		return err
+	}
+
+	var result []string
+	order := map[string]int64{}
+	for sha, bits := range paint {
+		if bits.has(0) && !bits.has(1) {
+			_, order[sha], _, _ = source.parents(sha)
+			result = append(result, sha)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return order[result[i]] > order[result[j]]
+	})
+	*commits = result
+	return nil
+}
@@ -0,0 +1,95 @@
+package clip_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+// newHistoryRepo creates a repository with diverged, merged and unrelated branches and
+// returns the sha of every branch
+func newHistoryRepo(root string) map[string]string {
+	commit := func(msg string) {
+		git(root, "commit", "-q", "--allow-empty", "-m", msg)
+	}
+	git(root, "init", "-q", "-b", "master")
+	commit("one")
+	commit("two")
+	git(root, "checkout", "-q", "-b", "feature")
+	commit("feature one")
+	commit("feature two")
+	git(root, "checkout", "-q", "-b", "merged")
+	commit("merged one")
+	git(root, "checkout", "-q", "master")
+	commit("three")
+	git(root, "merge", "-q", "--no-ff", "-m", "merge", "merged")
+	commit("four")
+	git(root, "checkout", "-q", "-b", "behind", "HEAD~3")
+	git(root, "checkout", "-q", "--orphan", "orphan")
+	commit("orphan one")
+	git(root, "checkout", "-q", "master")
+
+	shas := map[string]string{}
+	for _, name := range []string{"master", "feature", "merged", "behind", "orphan"} {
+		shas[name] = strings.TrimSpace(git(root, "rev-parse", name))
+	}
+	return shas
+}
+
+var _ = Describe("AheadBehind()", func() {
+	var root string
+	var shas map[string]string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-ahead-behind")
+		Expect(err).To(BeNil())
+		shas = newHistoryRepo(root)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Should count every pair in one call", func() {
+		repo := clip.NewRepository(clip.NewExecBackend(root))
+		pairs := []clip.RevPair{
+			{Branch: shas["feature"], Base: shas["master"]},
+			{Branch: shas["merged"], Base: shas["master"]},
+			{Branch: shas["behind"], Base: shas["master"]},
+			{Branch: shas["master"], Base: shas["master"]},
+			{Branch: shas["feature"], Base: shas["merged"]},
+		}
+		counts := clip.AheadBehindMap{}
+		Expect(repo.AheadBehind(counts, pairs)).To(Succeed())
+		Expect(counts[pairs[0]]).To(Equal(clip.AheadBehind{Ahead: 0, Behind: 4}))
+		Expect(counts[pairs[1]]).To(Equal(clip.AheadBehind{Ahead: 0, Behind: 3}))
+		Expect(counts[pairs[2]]).To(Equal(clip.AheadBehind{Ahead: 0, Behind: 6}))
+		Expect(counts[pairs[3]]).To(Equal(clip.AheadBehind{}))
+		Expect(counts[pairs[4]]).To(Equal(clip.AheadBehind{Ahead: 0, Behind: 1}))
+	})
+
+	It("Should agree with CommitsBetween() for unrelated histories", func() {
+		repo := clip.NewRepository(clip.NewExecBackend(root))
+		var pairs []clip.RevPair
+		for _, branch := range shas {
+			for _, base := range shas {
+				pairs = append(pairs, clip.RevPair{Branch: branch, Base: base})
+			}
+		}
+		counts := clip.AheadBehindMap{}
+		Expect(repo.AheadBehind(counts, pairs)).To(Succeed())
+
+		for _, pair := range pairs {
+			var ahead, behind []string
+			Expect(repo.CommitsBetween(&ahead, pair.Base, pair.Branch)).To(Succeed())
+			Expect(repo.CommitsBetween(&behind, pair.Branch, pair.Base)).To(Succeed())
+			Expect(counts[pair]).To(Equal(clip.AheadBehind{Ahead: len(ahead), Behind: len(behind)}),
+				"%s..%s", pair.Base, pair.Branch)
+		}
+	})
+})
@@ -0,0 +1,278 @@
+package clip
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// AnalyzeOpts configures Repository.Analyze()
+type AnalyzeOpts struct {
+	// Workers is the number of branches analyzed at once, defaults to the number of CPUs
+	Workers int
+	// Trunk names the trunk branch, see Repository.ResolveTrunk()
+	Trunk string
+	// Bases are additional branches every branch is compared against such as `origin/main`
+	// or `release/2.4`, if empty the bases are read from `clip.base`
+	Bases []string
+	// OnResult if set is called with each branch in report order as soon as it and the
+	// branches before it are analyzed, allowing results to be streamed. The trunk and bases
+	// of the report are set before the first call.
+	OnResult func(report *Report, branch *BranchDetail)
+}
+
+// Report is the result of Repository.Analyze()
+type Report struct {
+	// Trunk is the branch every other branch is compared against
+	Trunk *BranchDetail
+	// TrunkSource describes how the trunk was chosen, one of the TrunkFrom constants
+	TrunkSource string
+	// Bases are the additional branches counted in BranchDetail.Bases
+	Bases []*Branch
+	// Branches holds the trunk followed by every other local branch sorted by name
+	Branches []*BranchDetail
+	// Head is what HEAD of the current worktree points to
+	Head *Head
+	// Stashes are the stash entries made with HEAD detached or on a branch that no longer
+	// exists, the rest are in BranchDetail.Stashes
+	Stashes []Stash
+}
+
+// Analyze collects the detail of every local branch and counts the commits each branch is
+// ahead and behind the trunk and its remotes. Branches are analyzed concurrently and a
+// failure to analyze a branch is recorded in BranchDetail.Err rather than failing the
+// report. If 'ctx' is cancelled no more branches are started, the branches not analyzed
+// have their Err set to the context error which is also returned with the partial report.
+func (r *Repository) Analyze(ctx context.Context, opts AnalyzeOpts) (*Report, error) {
+	tracked := TrackedBranchMap{}
+	refs := BranchReferenceMap{}
+	details := BranchDetailMap{}
+
+	if err := r.ListTrackedBranches(tracked); err != nil {
+		return nil, err
+	}
+	if err := r.ListBranchRefs(refs); err != nil {
+		return nil, err
+	}
+	trunk, err := r.ResolveTrunk(opts.Trunk, refs)
+	if err != nil {
+		return nil, err
+	}
+	if err := MergeBranchDetail(details, refs, tracked); err != nil {
+		return nil, err
+	}
+	remotes, err := r.ListRemotes()
+	if err != nil {
+		return nil, err
+	}
+	for _, detail := range details {
+		detail.Upstream = UpstreamState(detail.Tracked, refs, remotes)
+	}
+	worktrees, err := r.ListWorktrees()
+	if err != nil {
+		return nil, err
+	}
+	r.LoadWorktreeStatus(worktrees)
+	for _, worktree := range worktrees {
+		if detail, ok := details[worktree.Branch]; ok {
+			detail.Worktree = worktree
+		}
+	}
+
+	report := &Report{Trunk: details[trunk.Name], TrunkSource: trunk.Source}
+	if report.Head, err = r.ResolveHead(worktrees); err != nil {
+		return nil, err
+	}
+	stashes, err := r.ListStashes()
+	if err != nil {
+		return nil, err
+	}
+	for _, stash := range stashes {
+		if detail, ok := details[stash.Branch]; ok {
+			detail.Stashes = append(detail.Stashes, stash)
+			continue
+		}
+		report.Stashes = append(report.Stashes, stash)
+	}
+	names := opts.Bases
+	if len(names) == 0 {
+		if names, err = r.ListBases(); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		base, err := ResolveBase(name, refs)
+		if err != nil {
+			return nil, err
+		}
+		report.Bases = append(report.Bases, base)
+	}
+
+	names = nil
+	for name := range details {
+		if name != trunk.Name {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	report.Branches = append(report.Branches, report.Trunk)
+	for _, name := range names {
+		report.Branches = append(report.Branches, details[name])
+	}
+	for _, detail := range report.Branches {
+		sortRemotes(detail.Remotes)
+	}
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	// Count every branch in a single walk of the history. If that fails each branch is
+	// counted on its own so the error is recorded against the branches that caused it.
+	var pairs []RevPair
+	for _, detail := range report.Branches {
+		pairs = append(pairs, branchPairs(detail, report)...)
+	}
+	counts := AheadBehindMap{}
+	if err := r.Backend.AheadBehind(counts, pairs); err != nil {
+		counts = nil
+	}
+	// Check every branch ahead of the trunk for squash and rebase merges at once, so the
+	// trunk history is only read once. On failure each branch is checked on its own.
+	var merged map[string]string
+	if counts != nil {
+		var shas []string
+		for _, detail := range report.Branches[1:] {
+			if counts[RevPair{Branch: detail.Sha, Base: report.Trunk.Sha}].Ahead != 0 {
+				shas = append(shas, detail.Sha)
+			}
+		}
+		merged = map[string]string{}
+		if err := r.MergedIntoAll(merged, shas, report.Trunk.Sha); err != nil {
+			merged = nil
+		}
+	}
+
+	// Results are passed to OnResult in report order as soon as every branch before them
+	// has finished
+	done := make(chan int)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ready := make([]bool, len(report.Branches))
+		next := 0
+		for idx := range done {
+			ready[idx] = true
+			for ; next < len(ready) && ready[next]; next++ {
+				if opts.OnResult != nil {
+					opts.OnResult(report, report.Branches[next])
+				}
+			}
+		}
+	}()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				detail := report.Branches[idx]
+				detail.Err = r.analyzeBranch(detail, report, counts, merged)
+				done <- idx
+			}
+		}()
+	}
+
+	for idx, detail := range report.Branches {
+		if err == nil {
+			select {
+			case jobs <- idx:
+				continue
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+		}
+		detail.Err = err
+		done <- idx
+	}
+	close(jobs)
+	wg.Wait()
+	close(done)
+	<-finished
+	return report, err
+}
+
+// branchPairs returns the pairs counted for 'detail', against the trunk, the bases and its
+// remotes
+func branchPairs(detail *BranchDetail, report *Report) []RevPair {
+	var pairs []RevPair
+	if detail != report.Trunk {
+		pairs = append(pairs, RevPair{Branch: detail.Sha, Base: report.Trunk.Sha})
+	}
+	for _, base := range report.Bases {
+		pairs = append(pairs, RevPair{Branch: detail.Sha, Base: base.Sha})
+	}
+	for _, remote := range detail.Remotes {
+		if remote != nil {
+			pairs = append(pairs, RevPair{Branch: detail.Sha, Base: remote.Sha})
+		}
+	}
+	return pairs
+}
+
+// analyzeBranch fills in the counts of 'detail' from 'counts' and how it was merged into
+// the trunk from 'merged'. If either is nil the branch is counted or checked on its own.
+func (r *Repository) analyzeBranch(detail *BranchDetail, report *Report, counts AheadBehindMap,
+	merged map[string]string) error {
+
+	trunk := report.Trunk
+	if counts == nil {
+		counts = AheadBehindMap{}
+		if err := r.Backend.AheadBehind(counts, branchPairs(detail, report)); err != nil {
+			return err
+		}
+	}
+
+	if detail != trunk {
+		detail.Trunk = counts[RevPair{Branch: detail.Sha, Base: trunk.Sha}]
+		if detail.Trunk.Ahead == 0 {
+			detail.Merged = MergedAncestor
+		} else if merged != nil {
+			detail.Merged = merged[detail.Sha]
+		} else {
+			how, err := r.MergedInto(detail.Sha, trunk.Sha)
+			if err != nil {
+				return err
+			}
+			detail.Merged = how
+		}
+	}
+	detail.Bases = nil
+	for _, base := range report.Bases {
+		detail.Bases = append(detail.Bases, BaseCount{
+			Base:        base.Name,
+			AheadBehind: counts[RevPair{Branch: detail.Sha, Base: base.Sha}],
+		})
+	}
+	detail.RemoteCounts = map[string]AheadBehind{}
+	for _, remote := range detail.Remotes {
+		if remote != nil {
+			detail.RemoteCounts[remote.Ref] = counts[RevPair{Branch: detail.Sha, Base: remote.Sha}]
+		}
+	}
+	return nil
+}
+
+// sortRemotes orders remote branches by ref with missing remotes last
+func sortRemotes(remotes []*Branch) {
+	sort.SliceStable(remotes, func(i, j int) bool {
+		if remotes[i] == nil || remotes[j] == nil {
+			return remotes[j] == nil && remotes[i] != nil
+		}
+		return remotes[i].Ref < remotes[j].Ref
+	})
+}
@@ -0,0 +1,130 @@
+package clip_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+func branchNames(report *clip.Report) []string {
+	var names []string
+	for _, branch := range report.Branches {
+		names = append(names, branch.Name)
+	}
+	return names
+}
+
+var _ = Describe("Analyze()", func() {
+	var backend *fakeBackend
+	var repo *clip.Repository
+
+	BeforeEach(func() {
+		backend = &fakeBackend{config: gitConfigNull, refs: gitShowRef}
+		repo = clip.NewRepository(backend)
+	})
+
+	It("Should report branches in a deterministic order", func() {
+		for _, workers := range []int{1, 4, 0} {
+			report, err := repo.Analyze(context.Background(), clip.AnalyzeOpts{Workers: workers})
+			Expect(err).To(BeNil())
+			Expect(report.Trunk.Name).To(Equal("master"))
+			Expect(branchNames(report)).To(Equal([]string{"master", "base-and-flake-fix",
+				"fix-me-local", "re-fix-version"}))
+			for _, branch := range report.Branches {
+				Expect(branch.Err).To(BeNil())
+			}
+		}
+	})
+
+	It("Should stream results in report order", func() {
+		var streamed []string
+		report, err := repo.Analyze(context.Background(), clip.AnalyzeOpts{
+			Workers: 4,
+			OnResult: func(report *clip.Report, branch *clip.BranchDetail) {
+				Expect(report.Trunk.Name).To(Equal("master"))
+				streamed = append(streamed, branch.Name)
+			},
+		})
+		Expect(err).To(BeNil())
+		Expect(streamed).To(Equal(branchNames(report)))
+	})
+
+	It("Should set the state of each upstream", func() {
+		backend.config += "remote.origin.url\n/tmp/origin.git\x00"
+		report, err := repo.Analyze(context.Background(), clip.AnalyzeOpts{})
+		Expect(err).To(BeNil())
+		upstreams := map[string]string{}
+		for _, branch := range report.Branches {
+			upstreams[branch.Name] = branch.Upstream
+		}
+		Expect(upstreams).To(Equal(map[string]string{
+			"master":             clip.UpstreamOK,
+			"base-and-flake-fix": "",
+			"fix-me-local":       clip.UpstreamRemoteMissing,
+			"re-fix-version":     "",
+		}))
+	})
+
+	It("Should count every branch with a single call", func() {
+		_, err := repo.Analyze(context.Background(), clip.AnalyzeOpts{Workers: 2})
+		Expect(err).To(BeNil())
+		Expect(backend.aheadBehinds).To(Equal(int32(1)))
+	})
+
+	It("Should record branch errors without failing the report", func() {
+		backend.failSha = "1a55f87bb9542848d1b19c2bde3f1552426a6b99"
+		report, err := repo.Analyze(context.Background(), clip.AnalyzeOpts{Workers: 2})
+		Expect(err).To(BeNil())
+		Expect(len(report.Branches)).To(Equal(4))
+		for _, branch := range report.Branches {
+			if branch.Name == "fix-me-local" {
+				Expect(branch.Err).To(MatchError("bad object " + backend.failSha))
+				continue
+			}
+			Expect(branch.Err).To(BeNil())
+		}
+	})
+
+	It("Should stop analyzing when the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		report, err := repo.Analyze(ctx, clip.AnalyzeOpts{Workers: 1})
+		Expect(err).To(Equal(context.Canceled))
+		Expect(len(report.Branches)).To(Equal(4))
+		var cancelled int
+		for _, branch := range report.Branches {
+			if branch.Err == context.Canceled {
+				cancelled++
+			}
+		}
+		Expect(cancelled).NotTo(BeZero())
+	})
+
+	It("Should count commits against the trunk and remotes", func() {
+		root, err := ioutil.TempDir("", "clip-analyze")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(root)
+		newHistoryRepo(root)
+		git(root, "update-ref", "refs/remotes/origin/feature", "feature~1")
+
+		backend, err := clip.NewNativeBackend(root)
+		Expect(err).To(BeNil())
+		report, err := clip.NewRepository(backend).Analyze(context.Background(), clip.AnalyzeOpts{})
+		Expect(err).To(BeNil())
+
+		details := map[string]*clip.BranchDetail{}
+		for _, branch := range report.Branches {
+			Expect(branch.Err).To(BeNil())
+			details[branch.Name] = branch
+		}
+		Expect(details["feature"].Trunk).To(Equal(clip.AheadBehind{Ahead: 0, Behind: 4}))
+		Expect(details["behind"].Trunk).To(Equal(clip.AheadBehind{Ahead: 0, Behind: 6}))
+		Expect(details["feature"].RemoteCounts).To(Equal(map[string]clip.AheadBehind{
+			"remotes/origin/feature": {Ahead: 1, Behind: 0},
+		}))
+	})
+})
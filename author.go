@@ -0,0 +1,79 @@
+package clip
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AuthorFilter matches commit authors by email, or by a regular expression wrapped in
+// slashes like `/^Derrick/` which is matched against `Name <email>`
+type AuthorFilter struct {
+	Pattern string
+	regex   *regexp.Regexp
+}
+
+// NewAuthorFilter compiles 'pattern' given to `--author`
+func NewAuthorFilter(pattern string) (*AuthorFilter, error) {
+	if pattern == "" {
+		return nil, errors.New("author pattern is empty")
+	}
+	filter := &AuthorFilter{Pattern: pattern}
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		regex, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid author pattern '%s'", pattern)
+		}
+		filter.regex = regex
+	}
+	return filter, nil
+}
+
+// Match returns true if 'author' is matched by the filter, emails are compared ignoring case
+func (a *AuthorFilter) Match(author Signature) bool {
+	if a.regex != nil {
+		return a.regex.MatchString(author.Name + " <" + author.Email + ">")
+	}
+	return strings.EqualFold(a.Pattern, author.Email)
+}
+
+// UserEmail returns `user.email` from git config
+func (r *Repository) UserEmail() (string, error) {
+	config := Config{}
+	if err := r.Backend.ListConfig(config, `^user\.email$`); err != nil {
+		return "", err
+	}
+	email := config.Get("user.email")
+	if email == "" {
+		return "", errors.New("'user.email' is not set; set it with 'git config user.email <email>'")
+	}
+	return email, nil
+}
+
+// AuthoredBy returns true if every commit 'branch' has that 'trunk' does not was authored
+// by someone 'filter' matches, a branch shared with another author is never matched. If
+// the trunk has every commit of the branch the author of its tip must match instead.
+// Branch.Commit must be loaded.
+func (r *Repository) AuthoredBy(filter *AuthorFilter, branch *Branch, trunk *Branch) (bool, error) {
+	var shas []string
+	if err := r.CommitsBetween(&shas, trunk.Sha, branch.Sha); err != nil {
+		return false, err
+	}
+	if len(shas) == 0 {
+		return branch.Commit != nil && filter.Match(branch.Commit.Author), nil
+	}
+
+	commits := map[string]*Commit{}
+	if err := r.LookupCommits(commits, shas); err != nil {
+		return false, err
+	}
+	for _, sha := range shas {
+		// The author of a missing commit is unknown
+		commit, ok := commits[sha]
+		if !ok || !filter.Match(commit.Author) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,100 @@
+package clip_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+// newAuthorsRepo creates remote branches authored by Clip, by Other and by both and a
+// branch merged into main
+func newAuthorsRepo(root string) {
+	git(root, "init", "-q", "-b", "main")
+	git(root, "commit", "-q", "--allow-empty", "-m", "init")
+	for _, name := range []string{"mine", "other", "mixed"} {
+		git(root, "checkout", "-q", "-b", name, "main")
+		writeFile(filepath.Join(root, name+".txt"), name+"\n")
+		git(root, "add", ".")
+		if name == "other" {
+			git(root, "commit", "-q", "--author", "Other <other@example.com>", "-m", name)
+		} else {
+			git(root, "commit", "-q", "-m", name)
+		}
+	}
+	// The tip of mixed is by Other but it has a commit by Clip
+	git(root, "commit", "-q", "--allow-empty", "--author", "Other <other@example.com>", "-m", "review")
+	git(root, "checkout", "-q", "main")
+	for _, name := range []string{"mine", "other", "mixed"} {
+		git(root, "update-ref", "refs/remotes/origin/"+name, name)
+		git(root, "branch", "-q", "-D", name)
+	}
+	git(root, "update-ref", "refs/remotes/origin/done", "main")
+}
+
+var _ = Describe("AuthorFilter", func() {
+	It("Should match emails ignoring case", func() {
+		filter, err := clip.NewAuthorFilter("Clip@Example.com")
+		Expect(err).To(BeNil())
+		Expect(filter.Match(clip.Signature{Name: "Clip", Email: "clip@example.com"})).To(Equal(true))
+		Expect(filter.Match(clip.Signature{Name: "Clip", Email: "clip@example.org"})).To(Equal(false))
+	})
+	It("Should match regular expressions against the name and email", func() {
+		filter, err := clip.NewAuthorFilter("/^Clip <.*@example.com>$/")
+		Expect(err).To(BeNil())
+		Expect(filter.Match(clip.Signature{Name: "Clip", Email: "a@example.com"})).To(Equal(true))
+		Expect(filter.Match(clip.Signature{Name: "Other", Email: "a@example.com"})).To(Equal(false))
+
+		_, err = clip.NewAuthorFilter("/(/")
+		Expect(err).NotTo(BeNil())
+	})
+	It("Should read user.email", func() {
+		repo := clip.NewRepository(&fakeBackend{config: "user.email\nclip@example.com\x00"})
+		email, err := repo.UserEmail()
+		Expect(err).To(BeNil())
+		Expect(email).To(Equal("clip@example.com"))
+
+		repo = clip.NewRepository(&fakeBackend{config: gitConfigNull})
+		_, err = repo.UserEmail()
+		Expect(err).To(MatchError("'user.email' is not set; set it with 'git config user.email <email>'"))
+	})
+
+	Describe("PlanRemoteDeletions()", func() {
+		var root string
+		var repo *clip.Repository
+
+		BeforeEach(func() {
+			var err error
+			root, err = ioutil.TempDir("", "clip-author")
+			Expect(err).To(BeNil())
+			newAuthorsRepo(root)
+			repo = clip.NewRepository(clip.NewExecBackend(root))
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(root)
+		})
+
+		planned := func(pattern string) []string {
+			filter, err := clip.NewAuthorFilter(pattern)
+			Expect(err).To(BeNil())
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", Author: filter})
+			Expect(err).To(BeNil())
+			var names []string
+			for _, deletion := range plan.Deletions {
+				names = append(names, deletion.Branch)
+			}
+			return names
+		}
+
+		It("Should plan branches whose commits are all by the author", func() {
+			Expect(planned("clip@example.com")).To(Equal([]string{"done", "mine"}))
+			Expect(planned("/^Other /")).To(Equal([]string{"other"}))
+			Expect(planned("/example.com/")).To(Equal([]string{"done", "mine", "mixed", "other"}))
+			Expect(planned("nobody@example.com")).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,265 @@
+package clip
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GitBackend is the set of git operations clip depends on. The default implementation
+// shells out to the `git` binary, alternate implementations can be injected into a
+// Repository for testing or speed.
+type GitBackend interface {
+	// ListConfig adds every config entry whose key matches the regex 'pattern' to 'result'
+	ListConfig(result Config, pattern string) error
+	// ListRefs adds all local and remote branches to 'result' organized by remote
+	ListRefs(result BranchReferenceMap) error
+	// SymbolicRef returns the full ref name the symbolic ref 'name' points to or an empty
+	// string if 'name' is not a symbolic ref
+	SymbolicRef(name string) (string, error)
+	// CommitsBetween returns the commits reachable from 'end' but not from 'begin'
+	CommitsBetween(commits *[]string, begin, end string) error
+	// LookupCommits adds the commit for each of 'shas' to 'result' keyed by sha, commits
+	// which don't exist are left out
+	LookupCommits(result map[string]*Commit, shas []string) error
+	// AheadBehind counts the commits ahead and behind for every pair in 'pairs'
+	AheadBehind(result AheadBehindMap, pairs []RevPair) error
+	// MergeBase returns the best common ancestor of 'shas' or an empty string if they share
+	// no history. With more than two shas the ancestor common to all of them is returned.
+	MergeBase(shas ...string) (string, error)
+	// CommitPatchIDs adds the patch id of each non merge commit listed by `git log 'revs'`
+	// to 'result' keyed by commit
+	CommitPatchIDs(result map[string]string, revs []string) error
+	// DiffPatchIDs adds the patch id of the change from Base to Branch of each of 'diffs'
+	// to 'result' keyed by Branch, pairs without changes are left out
+	DiffPatchIDs(result map[string]string, diffs []RevPair) error
+	// ListRemoteBranches asks the remote 'remote' for the sha of each of 'branches' and adds
+	// those that exist to 'result' keyed by branch name
+	ListRemoteBranches(result map[string]string, remote string, branches []string) error
+	// DeleteRemoteBranch deletes the branch 'branch' from the remote 'remote'
+	DeleteRemoteBranch(remote, branch string) error
+	// PushDelete deletes the branch of each of 'leases' from the remote 'remote' in a single
+	// push, atomically if 'atomic' is true, and appends the outcome for each ref to 'result'.
+	// A branch which no longer points to the sha of its lease is rejected.
+	PushDelete(result *[]PushResult, remote string, leases []Lease, atomic bool) error
+	// DeleteLocalBranch deletes the local branch 'branch' even if it's not fully merged
+	DeleteLocalBranch(branch string) error
+	// PushRef sets the ref 'ref' on the remote 'remote' to 'sha'
+	PushRef(remote, sha, ref string) error
+	// UpdateRef points the local ref 'ref' at 'sha' creating it if needed
+	UpdateRef(ref, sha string) error
+	// DeleteRef deletes the local ref 'ref'
+	DeleteRef(ref string) error
+	// GitCommonDir returns the git directory shared by all worktrees of the repository
+	GitCommonDir() (string, error)
+	// WorkTree returns the root of the work tree or an empty string for bare repositories
+	WorkTree() (string, error)
+	// Fetch fetches all of 'remotes' with a single `git fetch --multiple` pruning remote
+	// branches deleted on the remote, adding the error of each remote that could not be
+	// fetched to 'failed'. An error is returned if the fetch failed for any other reason or
+	// was stopped by cancelling 'ctx'.
+	Fetch(ctx context.Context, failed map[string]error, remotes []string) error
+	// FetchHeadPath returns the path of FETCH_HEAD for the current worktree
+	FetchHeadPath() (string, error)
+	// ListWorktrees appends every worktree of the repository to 'result'
+	ListWorktrees(result *[]*Worktree) error
+	// WorktreeStatus counts the uncommitted changes in the worktree at 'path' without
+	// taking any locks
+	WorktreeStatus(path string) (StatusCounts, error)
+	// TagsAt appends the names of the tags pointing at 'sha' to 'tags'
+	TagsAt(tags *[]string, sha string) error
+	// ListStashes appends the stash entries to 'result' newest first
+	ListStashes(result *[]Stash) error
+}
+
+// ExecBackend implements GitBackend by running the `git` binary
+type ExecBackend struct {
+	// The directory git is run from, if empty the current working directory is used
+	Dir string
+	// Env if not nil is the environment git is run with instead of our own
+	Env []string
+}
+
+func NewExecBackend(dir string) *ExecBackend {
+	return &ExecBackend{Dir: dir}
+}
+
+func (b *ExecBackend) ListConfig(result Config, pattern string) error {
+	var output string
+	if err := b.git(&output, "config", "--null", "--get-regexp", pattern); err != nil {
+		// `git config` exits with 1 if no keys matched the pattern
+		if isExitCode(err, 1) {
+			return nil
+		}
+		return err
+	}
+	return ParseConfigList(result, output)
+}
+
+func (b *ExecBackend) ListRefs(result BranchReferenceMap) error {
+	var output string
+	if err := b.git(&output, "show-ref"); err != nil {
+		// `git show-ref` exits with 1 if the repository has no refs
+		if isExitCode(err, 1) {
+			return nil
+		}
+		return err
+	}
+	return ParseBranchRefs(result, output)
+}
+
+func (b *ExecBackend) CommitsBetween(commits *[]string, begin, end string) error {
+	if begin == end {
+		return nil
+	}
+	var output string
+	if err := b.git(&output, "log", "--pretty=%H", begin+".."+end); err != nil {
+		return errors.Wrap(err, "CommitsBetween()")
+	}
+	output = strings.TrimSpace(output)
+	if output == "" {
+		return nil
+	}
+	*commits = strings.Split(output, "\n")
+	return nil
+}
+
+func (b *ExecBackend) DeleteRemoteBranch(remote, branch string) error {
+	var output string
+	return b.git(&output, "push", remote, "--delete", branch)
+}
+
+func (b *ExecBackend) DeleteLocalBranch(branch string) error {
+	var output string
+	return b.git(&output, "branch", "-D", branch)
+}
+
+func (b *ExecBackend) PushRef(remote, sha, ref string) error {
+	var output string
+	return b.git(&output, "push", remote, sha+":"+ref)
+}
+
+func (b *ExecBackend) UpdateRef(ref, sha string) error {
+	var output string
+	return b.git(&output, "update-ref", ref, sha)
+}
+
+func (b *ExecBackend) DeleteRef(ref string) error {
+	var output string
+	return b.git(&output, "update-ref", "-d", ref)
+}
+
+func (b *ExecBackend) GitCommonDir() (string, error) {
+	var output string
+	if err := b.git(&output, "rev-parse", "--git-common-dir"); err != nil {
+		return "", errors.Wrap(err, "GitCommonDir()")
+	}
+	dir := strings.TrimSpace(output)
+	// Relative to the directory git was run from
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(b.Dir, dir)
+	}
+	return filepath.Abs(dir)
+}
+
+// git runs a git sub command from the backend's directory and stores stdout in 'buf'
+func (b *ExecBackend) git(buf *string, args ...string) error {
+	return b.gitInput(buf, "", args...)
+}
+
+// gitInput is like git() but writes 'input' to the stdin of the command
+func (b *ExecBackend) gitInput(buf *string, input string, args ...string) error {
+	return b.gitContext(context.Background(), buf, input, args...)
+}
+
+// gitContext is like gitInput() but kills the command if 'ctx' is cancelled
+func (b *ExecBackend) gitContext(ctx context.Context, buf *string, input string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = b.Dir
+	cmd.Env = b.Env
+	cmd.Stderr = &stderr
+	if input != "" {
+		cmd.Stdin = strings.NewReader(input)
+	}
+
+	output, err := cmd.Output()
+	// Some commands like `git push --porcelain` report on stdout even when they fail
+	*buf = string(output)
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return errors.Wrapf(err, "error running 'git %s': %s", args, msg)
+		}
+		return errors.Wrapf(err, "error running 'git %s'", args)
+	}
+	return nil
+}
+
+// isExitCode returns true if 'err' was caused by a command that exited with 'code'
+func isExitCode(err error, code int) bool {
+	if exitErr, ok := errors.Cause(err).(*exec.ExitError); ok {
+		return exitErr.ExitCode() == code
+	}
+	return false
+}
+
+// Repository provides access to a git repository through a GitBackend
+type Repository struct {
+	Backend GitBackend
+}
+
+func NewRepository(backend GitBackend) *Repository {
+	return &Repository{Backend: backend}
+}
+
+// DefaultRepository is the repository in the current working directory used by
+// the package level functions
+var DefaultRepository = NewRepository(NewExecBackend(""))
+
+func (r *Repository) ListTrackedBranches(result TrackedBranchMap) error {
+	config := Config{}
+	if err := r.Backend.ListConfig(config, `^branch\.|^remote\.pushdefault$`); err != nil {
+		return err
+	}
+	return ParseTrackedConfig(result, config)
+}
+
+func (r *Repository) ListBranchRefs(result BranchReferenceMap) error {
+	return r.Backend.ListRefs(result)
+}
+
+func (r *Repository) CommitsBetween(commits *[]string, begin, end string) error {
+	return r.Backend.CommitsBetween(commits, begin, end)
+}
+
+func (r *Repository) DeleteRemoteBranch(remote, branch string) error {
+	return r.Backend.DeleteRemoteBranch(remote, branch)
+}
+
+// DeleteLocalBranch deletes 'branch' unless it's checked out in another worktree
+func (r *Repository) DeleteLocalBranch(branch string) error {
+	worktrees, err := r.ListWorktrees()
+	if err != nil {
+		return err
+	}
+	if worktree := CheckedOut(worktrees, branch); worktree != nil {
+		return errors.Errorf("refusing to delete '%s'; it is checked out in worktree '%s'",
+			branch, worktree.Path)
+	}
+	return r.Backend.DeleteLocalBranch(branch)
+}
+
+// CurrentBranch returns the name of the branch checked out in the working tree or an empty
+// string if HEAD is detached
+func (r *Repository) CurrentBranch() (string, error) {
+	target, err := r.Backend.SymbolicRef("HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(target, "refs/heads/"), nil
+}
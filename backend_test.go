@@ -0,0 +1,274 @@
+package clip_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var gitConfigNull = "branch.master.remote\norigin\x00" +
+	"branch.master.merge\nrefs/heads/master\x00" +
+	"branch.fix-me-local.merge\nrefs/heads/fix-version\x00" +
+	"branch.fix-me-local.remote\nupstream\x00" +
+	"branch.Fix Me.v2.remote\norigin\x00" +
+	"branch.Fix Me.v2.merge\nrefs/heads/fix-me\x00"
+
+// fakeBackend implements clip.GitBackend from static git output
+type fakeBackend struct {
+	config  string
+	refs    string
+	deleted []string
+	// AheadBehind fails for pairs with this branch sha
+	failSha string
+	// aheadBehinds counts calls to AheadBehind
+	aheadBehinds int32
+	symbolic     map[string]string
+	commits      map[string]*clip.Commit
+	pushed       []string
+	gitDir       string
+	workTree     string
+	// PushDelete rejects these branches with the reason given
+	reject map[string]string
+	// pushes counts calls to PushDelete
+	pushes int
+	// anchors are the local refs set by UpdateRef
+	anchors map[string]string
+	// anchorErr if set is returned by UpdateRef
+	anchorErr error
+	worktrees []*clip.Worktree
+	tags      map[string][]string
+	stashes   string
+}
+
+func (f *fakeBackend) ListConfig(result clip.Config, pattern string) error {
+	return clip.ParseConfigList(result, f.config)
+}
+
+func (f *fakeBackend) ListRefs(result clip.BranchReferenceMap) error {
+	return clip.ParseBranchRefs(result, f.refs)
+}
+
+func (f *fakeBackend) LookupCommits(result map[string]*clip.Commit, shas []string) error {
+	for _, sha := range shas {
+		if commit, ok := f.commits[sha]; ok {
+			result[sha] = commit
+		}
+	}
+	return nil
+}
+
+func (f *fakeBackend) SymbolicRef(name string) (string, error) {
+	return f.symbolic[name], nil
+}
+
+func (f *fakeBackend) CommitsBetween(commits *[]string, begin, end string) error {
+	return nil
+}
+
+func (f *fakeBackend) AheadBehind(result clip.AheadBehindMap, pairs []clip.RevPair) error {
+	atomic.AddInt32(&f.aheadBehinds, 1)
+	for _, pair := range pairs {
+		if pair.Branch == f.failSha {
+			return errors.New("bad object " + f.failSha)
+		}
+		result[pair] = clip.AheadBehind{}
+	}
+	return nil
+}
+
+func (f *fakeBackend) MergeBase(shas ...string) (string, error) {
+	return "", nil
+}
+
+func (f *fakeBackend) CommitPatchIDs(result map[string]string, revs []string) error {
+	return nil
+}
+
+func (f *fakeBackend) DiffPatchIDs(result map[string]string, diffs []clip.RevPair) error {
+	return nil
+}
+
+func (f *fakeBackend) DeleteRemoteBranch(remote, branch string) error {
+	f.deleted = append(f.deleted, remote+"/"+branch)
+	return nil
+}
+
+func (f *fakeBackend) PushDelete(result *[]clip.PushResult, remote string, leases []clip.Lease, atomic bool) error {
+	f.pushes++
+	rejected := false
+	for _, lease := range leases {
+		if _, ok := f.reject[lease.Branch]; ok {
+			rejected = true
+		}
+	}
+	for _, lease := range leases {
+		branch := lease.Branch
+		push := clip.PushResult{Ref: "refs/heads/" + branch, Flag: "-", Summary: "[deleted]"}
+		if reason, ok := f.reject[branch]; ok {
+			push = clip.PushResult{Ref: push.Ref, Flag: "!", Summary: "[remote rejected]", Reason: reason}
+		} else if atomic && rejected {
+			push = clip.PushResult{Ref: push.Ref, Flag: "!", Summary: "[remote rejected]",
+				Reason: "atomic push failure"}
+		} else {
+			push.Old = lease.Sha
+			f.deleted = append(f.deleted, remote+"/"+branch)
+		}
+		*result = append(*result, push)
+	}
+	return nil
+}
+
+// ListRemoteBranches treats the remote branches in 'refs' as the branches on the remote
+func (f *fakeBackend) ListRemoteBranches(result map[string]string, remote string, branches []string) error {
+	refs := clip.BranchReferenceMap{}
+	if err := clip.ParseBranchRefs(refs, f.refs); err != nil {
+		return err
+	}
+	for _, branch := range branches {
+		if ref, ok := refs[remote][branch]; ok {
+			result[branch] = ref.Sha
+		}
+	}
+	return nil
+}
+
+func (f *fakeBackend) PushRef(remote, sha, ref string) error {
+	f.pushed = append(f.pushed, remote+" "+sha+":"+ref)
+	return nil
+}
+
+func (f *fakeBackend) UpdateRef(ref, sha string) error {
+	if f.anchorErr != nil {
+		return f.anchorErr
+	}
+	if f.anchors == nil {
+		f.anchors = map[string]string{}
+	}
+	f.anchors[ref] = sha
+	return nil
+}
+
+func (f *fakeBackend) DeleteRef(ref string) error {
+	delete(f.anchors, ref)
+	return nil
+}
+
+func (f *fakeBackend) GitCommonDir() (string, error) {
+	return f.gitDir, nil
+}
+
+func (f *fakeBackend) WorkTree() (string, error) {
+	return f.workTree, nil
+}
+
+func (f *fakeBackend) Fetch(ctx context.Context, failed map[string]error, remotes []string) error {
+	return nil
+}
+
+func (f *fakeBackend) FetchHeadPath() (string, error) {
+	return filepath.Join(f.gitDir, "FETCH_HEAD"), nil
+}
+
+func (f *fakeBackend) ListWorktrees(result *[]*clip.Worktree) error {
+	*result = append(*result, f.worktrees...)
+	return nil
+}
+
+func (f *fakeBackend) WorktreeStatus(path string) (clip.StatusCounts, error) {
+	for _, worktree := range f.worktrees {
+		if worktree.Path == path {
+			return worktree.Status, nil
+		}
+	}
+	return clip.StatusCounts{}, errors.New("no worktree at " + path)
+}
+
+func (f *fakeBackend) TagsAt(tags *[]string, sha string) error {
+	*tags = append(*tags, f.tags[sha]...)
+	return nil
+}
+
+func (f *fakeBackend) ListStashes(result *[]clip.Stash) error {
+	return clip.ParseStashList(result, f.stashes)
+}
+
+func (f *fakeBackend) DeleteLocalBranch(branch string) error {
+	f.deleted = append(f.deleted, branch)
+	return nil
+}
+
+var _ = Describe("Repository", func() {
+	var backend *fakeBackend
+	var repo *clip.Repository
+
+	BeforeEach(func() {
+		backend = &fakeBackend{config: gitConfigNull, refs: gitShowRef}
+		repo = clip.NewRepository(backend)
+	})
+
+	Describe("ListTrackedBranches()", func() {
+		It("Should list tracked branches from the backend config", func() {
+			tracked := clip.TrackedBranchMap{}
+			err := repo.ListTrackedBranches(tracked)
+			Expect(err).To(BeNil())
+			Expect(len(tracked)).To(Equal(3))
+			Expect(tracked["master"].Remote).To(Equal("origin"))
+			Expect(tracked["master"].Merge).To(Equal("refs/heads/master"))
+		})
+		It("Should name tracked branches even if merge is listed before remote", func() {
+			tracked := clip.TrackedBranchMap{}
+			err := repo.ListTrackedBranches(tracked)
+			Expect(err).To(BeNil())
+			Expect(tracked["fix-me-local"].Name).To(Equal("fix-me-local"))
+			Expect(tracked["fix-me-local"].Remote).To(Equal("upstream"))
+			Expect(tracked["fix-me-local"].Merge).To(Equal("refs/heads/fix-version"))
+		})
+		It("Should handle branch names with spaces and dots", func() {
+			tracked := clip.TrackedBranchMap{}
+			err := repo.ListTrackedBranches(tracked)
+			Expect(err).To(BeNil())
+			Expect(tracked["Fix Me.v2"].Remote).To(Equal("origin"))
+			Expect(tracked["Fix Me.v2"].Merge).To(Equal("refs/heads/fix-me"))
+		})
+	})
+	Describe("ListBranchRefs()", func() {
+		It("Should list branch refs from the backend", func() {
+			refs := clip.BranchReferenceMap{}
+			err := repo.ListBranchRefs(refs)
+			Expect(err).To(BeNil())
+			Expect(len(refs["local"])).To(Equal(4))
+			Expect(len(refs["origin"])).To(Equal(5))
+		})
+	})
+	Describe("CurrentBranch()", func() {
+		It("Should return the branch HEAD points to", func() {
+			backend.symbolic = map[string]string{"HEAD": "refs/heads/fix-me-local"}
+			current, err := repo.CurrentBranch()
+			Expect(err).To(BeNil())
+			Expect(current).To(Equal("fix-me-local"))
+		})
+		It("Should return an empty string if HEAD is detached", func() {
+			current, err := repo.CurrentBranch()
+			Expect(err).To(BeNil())
+			Expect(current).To(Equal(""))
+		})
+	})
+	Describe("DeleteLocalBranch()", func() {
+		It("Should delete through the backend", func() {
+			Expect(repo.DeleteLocalBranch("fix-me-local")).To(Succeed())
+			Expect(backend.deleted).To(Equal([]string{"fix-me-local"}))
+		})
+	})
+	Describe("DeleteRemoteBranch()", func() {
+		It("Should delete through the backend", func() {
+			err := repo.DeleteRemoteBranch("origin", "fix-version")
+			Expect(err).To(BeNil())
+			Expect(backend.deleted).To(Equal([]string{"origin/fix-version"}))
+		})
+	})
+})
@@ -0,0 +1,48 @@
+package clip
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BaseCount is the number of commits a branch is ahead and behind one of Report.Bases
+type BaseCount struct {
+	// Base is the name of the base as given to AnalyzeOpts.Bases or `clip.base`
+	Base string
+	AheadBehind
+}
+
+// ListBases returns the bases configured with `clip.base`, which may be given more than once
+func (r *Repository) ListBases() ([]string, error) {
+	config := Config{}
+	if err := r.Backend.ListConfig(config, `^clip\.base$`); err != nil {
+		return nil, err
+	}
+	var bases []string
+	for _, value := range config.GetAll("clip.base") {
+		// Allow a comma separated list like `--base`
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				bases = append(bases, name)
+			}
+		}
+	}
+	return bases, nil
+}
+
+// ResolveBase finds the branch 'name' refers to. A local branch is preferred, otherwise
+// 'name' is taken as `<remote>/<branch>`. The returned branch is named 'name'.
+func ResolveBase(name string, refs BranchReferenceMap) (*Branch, error) {
+	branch, ok := refs["local"][name]
+	// Remote names may contain slashes so try every split
+	for idx := 0; !ok && idx < len(name); idx++ {
+		if name[idx] == '/' && name[:idx] != "local" {
+			branch, ok = refs[name[:idx]][name[idx+1:]]
+		}
+	}
+	if !ok {
+		return nil, errors.Errorf("base branch '%s' does not exist", name)
+	}
+	return &Branch{Name: name, Ref: branch.Ref, Sha: branch.Sha}, nil
+}
@@ -0,0 +1,77 @@
+package clip_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var _ = Describe("Bases", func() {
+	var refs clip.BranchReferenceMap
+
+	BeforeEach(func() {
+		refs = clip.BranchReferenceMap{}
+		Expect(clip.ParseBranchRefs(refs, gitShowRef)).To(Succeed())
+	})
+
+	Describe("ResolveBase()", func() {
+		It("Should prefer local branches", func() {
+			base, err := clip.ResolveBase("master", refs)
+			Expect(err).To(BeNil())
+			Expect(base.Name).To(Equal("master"))
+			Expect(base.Ref).To(Equal("heads/master"))
+		})
+		It("Should resolve remote branches", func() {
+			base, err := clip.ResolveBase("upstream/fix-version", refs)
+			Expect(err).To(BeNil())
+			Expect(base.Name).To(Equal("upstream/fix-version"))
+			Expect(base.Sha).To(Equal("ac0ff092a6bd193fe73660a8f0302e5ed32911dc"))
+		})
+		It("Should error if the base does not exist", func() {
+			_, err := clip.ResolveBase("origin/release/2.4", refs)
+			Expect(err).To(MatchError("base branch 'origin/release/2.4' does not exist"))
+		})
+	})
+
+	Describe("ListBases()", func() {
+		It("Should list every clip.base", func() {
+			repo := clip.NewRepository(&fakeBackend{
+				config: "clip.base\norigin/master\x00clip.base\nrelease/2.4, release/2.5\x00",
+			})
+			bases, err := repo.ListBases()
+			Expect(err).To(BeNil())
+			Expect(bases).To(Equal([]string{"origin/master", "release/2.4", "release/2.5"}))
+		})
+	})
+
+	It("Should count every branch against each base", func() {
+		root, err := ioutil.TempDir("", "clip-bases")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(root)
+		newHistoryRepo(root)
+		git(root, "update-ref", "refs/remotes/origin/master", "master~1")
+
+		repo := clip.NewRepository(nativeBackend(root))
+		report, err := repo.Analyze(context.Background(), clip.AnalyzeOpts{
+			Bases: []string{"origin/master", "behind"},
+		})
+		Expect(err).To(BeNil())
+		Expect(report.Bases[0].Name).To(Equal("origin/master"))
+		Expect(report.Trunk.Bases).To(Equal([]clip.BaseCount{
+			{Base: "origin/master", AheadBehind: clip.AheadBehind{Ahead: 1}},
+			{Base: "behind", AheadBehind: clip.AheadBehind{Ahead: 6}},
+		}))
+		for _, branch := range report.Branches {
+			if branch.Name == "behind" {
+				Expect(branch.Bases).To(Equal([]clip.BaseCount{
+					{Base: "origin/master", AheadBehind: clip.AheadBehind{Behind: 5}},
+					{Base: "behind"},
+				}))
+			}
+		}
+	})
+})
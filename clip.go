@@ -15,6 +15,10 @@ type TrackedBranch struct {
 	Name   string
 	Remote string
 	Merge  string
+	// The remote `git push` will push this branch to
+	PushRemote string
+	// The value of `branch.<name>.rebase`
+	Rebase string
 }
 
 type TrackedBranchMap map[string]*TrackedBranch
@@ -23,6 +27,8 @@ type Branch struct {
 	Name string
 	Ref  string
 	Sha  string
+	// Commit is the tip of the branch, filled in by Repository.LoadCommits()
+	Commit *Commit
 }
 
 type BranchMap map[string]*Branch
@@ -34,6 +40,24 @@ type BranchDetail struct {
 	Sha     string
 	Remotes []*Branch
 	Tracked *TrackedBranch
+	// Upstream is the state of the tracked branch, one of the Upstream constants or empty if
+	// the branch doesn't track anything
+	Upstream string
+	// Worktree is the worktree the branch is checked out in or nil if it's not checked out
+	Worktree *Worktree
+	// Stashes are the stash entries made on the branch newest first
+	Stashes []Stash
+	// Commits ahead and behind the trunk, filled in by Repository.Analyze()
+	Trunk AheadBehind
+	// Commits ahead and behind each of Report.Bases in the same order
+	Bases []BaseCount
+	// Merged is how the branch was merged into the trunk, one of the Merged constants or
+	// empty if the branch has changes the trunk does not
+	Merged string
+	// Commits ahead and behind each of the remote branches keyed by remote ref
+	RemoteCounts map[string]AheadBehind
+	// Err is set if the branch could not be analyzed
+	Err error
 }
 
 type BranchDetailMap map[string]*BranchDetail
@@ -55,12 +79,7 @@ func NewBranchDetail(branch *Branch) *BranchDetail {
 }
 
 func ListTrackedBranches(result TrackedBranchMap) error {
-	var output string
-	// Using git config list all the tracked branch entries
-	if err := Run(&output, "git", "config", "--get-regexp", "^branch\\."); err != nil {
-		return err
-	}
-	return ParseTrackedBranches(result, output)
+	return DefaultRepository.ListTrackedBranches(result)
 }
 
 // ParseTrackedBranches parses the output of `git config` and return a structure that looks like
@@ -71,38 +90,23 @@ func ListTrackedBranches(result TrackedBranchMap) error {
 //	}
 //
 func ParseTrackedBranches(result TrackedBranchMap, input string) error {
-	regexBranch, _ := regexp.Compile(`branch\.(.*?)\.remote (.+)`)
-	regexMerge, _ := regexp.Compile(`branch\.(.*?)\.merge ((refs\/)?heads\/)?(.+)`)
+	regexBranch := regexp.MustCompile(`^branch\.(.+)\.(remote|merge|pushremote|rebase) (.*)$`)
+	regexPushDefault := regexp.MustCompile(`^remote\.pushdefault (.*)$`)
 
+	config := Config{}
 	for _, line := range strings.Split(input, "\n") {
-		branch := regexBranch.FindStringSubmatch(line)
-		if len(branch) != 0 {
-			if tracked, ok := result[branch[1]]; ok {
-				tracked.Remote = branch[2]
-			} else {
-				result[branch[1]] = &TrackedBranch{Name: branch[1], Remote: branch[2]}
-			}
+		if match := regexBranch.FindStringSubmatch(line); len(match) != 0 {
+			config.Add(fmt.Sprintf("branch.%s.%s", match[1], match[2]), match[3])
 		}
-		merge := regexMerge.FindStringSubmatch(line)
-		if len(merge) != 0 {
-			name := strings.Split(line, " ")[1]
-			if tracked, ok := result[merge[1]]; ok {
-				tracked.Merge = name
-			} else {
-				result[merge[1]] = &TrackedBranch{Merge: name}
-			}
+		if match := regexPushDefault.FindStringSubmatch(line); len(match) != 0 {
+			config.Add("remote.pushdefault", match[1])
 		}
 	}
-	return nil
+	return ParseTrackedConfig(result, config)
 }
 
 func ListBranchRefs(result map[string]BranchMap) error {
-	var output string
-	// Using git show-ref
-	if err := Run(&output, "git", "show-ref"); err != nil {
-		return err
-	}
-	return ParseBranchRefs(result, output)
+	return DefaultRepository.ListBranchRefs(result)
 }
 
 // ParseBranchRefs parses the output of `git show-ref` and return a structure that looks like
@@ -124,36 +128,42 @@ func ListBranchRefs(result map[string]BranchMap) error {
 //	}
 //
 func ParseBranchRefs(all map[string]BranchMap, input string) error {
-	regexLocal, _ := regexp.Compile(`^heads\/(.+)$`)
-	regexRemote, _ := regexp.Compile(`^remotes\/(.+?)\/(.+)$`)
-
 	for _, line := range strings.Split(input, "\n") {
 		ref := strings.Split(line, "refs/")
 		if len(ref) != 2 {
 			continue
 		}
-		// Is a local Branch
-		match := regexLocal.FindStringSubmatch(ref[1])
-		if len(match) != 0 {
-			if local, ok := all["local"]; ok {
-				local[match[1]] = NewBranch(match[1], ref[1], ref[0])
-			} else {
-				all["local"] = BranchMap{}
-				all["local"][match[1]] = NewBranch(match[1], ref[1], ref[0])
-			}
+		addBranchRef(all, ref[1], ref[0])
+	}
+	return nil
+}
+
+var regexLocal = regexp.MustCompile(`^heads\/(.+)$`)
+var regexRemote = regexp.MustCompile(`^remotes\/(.+?)\/(.+)$`)
+
+// addBranchRef adds 'ref' (a ref name without the 'refs/' prefix) to 'all' if it's
+// a local or remote branch
+func addBranchRef(all map[string]BranchMap, ref, sha string) {
+	// Is a local Branch
+	match := regexLocal.FindStringSubmatch(ref)
+	if len(match) != 0 {
+		if local, ok := all["local"]; ok {
+			local[match[1]] = NewBranch(match[1], ref, sha)
+		} else {
+			all["local"] = BranchMap{}
+			all["local"][match[1]] = NewBranch(match[1], ref, sha)
 		}
-		// Is a Remote Branch
-		match = regexRemote.FindStringSubmatch(ref[1])
-		if len(match) != 0 {
-			if remote, ok := all[match[1]]; ok {
-				remote[match[2]] = NewBranch(match[2], ref[1], ref[0])
-			} else {
-				all[match[1]] = BranchMap{}
-				all[match[1]][match[2]] = NewBranch(match[2], ref[1], ref[0])
-			}
+	}
+	// Is a Remote Branch
+	match = regexRemote.FindStringSubmatch(ref)
+	if len(match) != 0 {
+		if remote, ok := all[match[1]]; ok {
+			remote[match[2]] = NewBranch(match[2], ref, sha)
+		} else {
+			all[match[1]] = BranchMap{}
+			all[match[1]][match[2]] = NewBranch(match[2], ref, sha)
 		}
 	}
-	return nil
 }
 
 func FindTrackedBranches(result *BranchDetail, refs BranchReferenceMap, tracked TrackedBranchMap) error {
@@ -161,14 +171,21 @@ func FindTrackedBranches(result *BranchDetail, refs BranchReferenceMap, tracked
 	if trackedBranch, ok := tracked[result.Name]; ok {
 		result.Tracked = trackedBranch
 
+		// Without a merge ref the upstream is misconfigured, see UpstreamState()
+		if trackedBranch.Merge == "" {
+			return nil
+		}
+
 		// If the remote tracked branch name differs from the local branch name
 		if !strings.HasSuffix(trackedBranch.Merge, result.Name) {
 			remote, err := GetRemoteBranchName(trackedBranch.Merge)
 			if err != nil {
 				return errors.Wrap(err, "FindTrackedBranches()")
 			}
-			// Add this branch to our list of remotes
-			result.Remotes = append(result.Remotes, refs[trackedBranch.Remote][remote])
+			// Add this branch to our list of remotes unless the upstream is gone, see UpstreamState()
+			if branch, ok := refs[trackedBranch.Remote][remote]; ok {
+				result.Remotes = append(result.Remotes, branch)
+			}
 		}
 	}
 	return nil
@@ -189,7 +206,6 @@ func FindRemoteBranches(detail *BranchDetail, refs BranchReferenceMap, tracked T
 }
 
 func MergeBranchDetail(result BranchDetailMap, refs BranchReferenceMap, tracked TrackedBranchMap) error {
-	foundTrunk := false
 	for remote, branches := range refs {
 		// Only interested in local branches
 		if remote != "local" {
@@ -206,35 +222,14 @@ func MergeBranchDetail(result BranchDetailMap, refs BranchReferenceMap, tracked
 				return err
 			}
 
-			// Since the main branch could be main or master or something else
-			if name == "main" || name == "master" || name == "trunk" {
-				name = "_trunk_"
-				foundTrunk = true
-			}
-
 			result[name] = detail
 		}
 	}
-	if !foundTrunk {
-		return errors.New("No local branch named 'main', 'master', or 'trunk'")
-	}
 	return nil
 }
 
 func CommitsBetween(commits *[]string, begin, end string) error {
-	if begin == end {
-		return nil
-	}
-	var output string
-	if err := Run(&output, "git", "log", "--pretty='%h'", fmt.Sprintf("%s..%s", begin, end)); err != nil {
-		return errors.Wrap(err, "CommitsBetween()")
-	}
-	output = strings.TrimSpace(output)
-	if output == "" {
-		return nil
-	}
-	*commits = strings.Split(output, "\n")
-	return nil
+	return DefaultRepository.CommitsBetween(commits, begin, end)
 }
 
 func Run(buf *string, name string, args ...string) error {
@@ -293,28 +288,39 @@ type Opts struct {
 	Validate func(string) bool
 }
 
-func readInput(opts Opts, msg string, args ...interface{}) string {
-	reader := bufio.NewReader(os.Stdin)
+// stdin is shared by every prompt so input buffered by one prompt is not lost to the next
+var stdin = bufio.NewReader(os.Stdin)
+
+// readInput prompts with 'msg' and returns the line entered, or the default if the line is
+// empty. An error is returned if the input ends before a line is entered.
+func readInput(opts Opts, msg string, args ...interface{}) (string, error) {
 	fmt.Printf("%s > ", fmt.Sprintf(msg, args...))
-	input, _ := reader.ReadString('\n')
+	input, err := stdin.ReadString('\n')
 	input = strings.TrimSpace(input)
 	if input == "" {
-		return opts.Default
+		if err != nil {
+			return "", err
+		}
+		return opts.Default, nil
 	}
-	return input
+	return input, nil
 }
 
+// YesNo asks a yes or no question until it's answered. If the input ends first the answer
+// is no, so nothing is deleted when there is nobody to ask.
 func YesNo(opts Opts, msg string, args ...interface{}) bool {
-	isYes, _ := regexp.Compile(`^(Y|y)$`)
-	isNo, _ := regexp.Compile(`^(N|n)$`)
-
 	for {
-		input := readInput(opts, fmt.Sprintf("%s (Y/N)", msg), args...)
-		if isYes.MatchString(input) {
-			return true
+		input, err := readInput(opts, fmt.Sprintf("%s (Y/N)", msg), args...)
+		if err != nil {
+			fmt.Println()
+			return false
 		}
-		if isNo.MatchString(input) {
+		switch strings.ToLower(input) {
+		case "y", "yes":
+			return true
+		case "n", "no":
 			return false
 		}
+		fmt.Println("Please answer Y or N")
 	}
 }
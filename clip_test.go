@@ -142,6 +142,16 @@ var _ = Describe("pkg.clip", func() {
 			Expect(detail.Tracked.Remote).To(Equal("upstream"))
 			Expect(detail.Tracked.Merge).To(Equal("refs/heads/fix-version"))
 		})
+
+		It("Should not add remotes for gone or misconfigured upstreams", func() {
+			tracked["gone"] = &clip.TrackedBranch{Name: "gone", Remote: "origin", Merge: "refs/heads/deleted"}
+			tracked["half"] = &clip.TrackedBranch{Name: "half", Remote: "origin"}
+			for _, name := range []string{"gone", "half"} {
+				detail = clip.NewBranchDetail(clip.NewBranch(name, "", ""))
+				Expect(clip.FindTrackedBranches(detail, refs, tracked)).To(Succeed())
+				Expect(detail.Remotes).To(BeEmpty())
+			}
+		})
 	})
 	Describe("FindRemoteBranches()", func() {
 		var detail *clip.BranchDetail
@@ -276,4 +286,40 @@ var _ = Describe("pkg.clip", func() {
 			Expect(result).To(Equal(false))
 		})
 	})
+	Describe("UpstreamState()", func() {
+		var refs clip.BranchReferenceMap
+		remotes := map[string]bool{"origin": true, "upstream": true}
+
+		BeforeEach(func() {
+			refs = clip.BranchReferenceMap{}
+			err := clip.ParseBranchRefs(refs, gitShowRef)
+			Expect(err).To(BeNil())
+		})
+
+		It("Should return ok if the upstream exists", func() {
+			tracked := &clip.TrackedBranch{Remote: "upstream", Merge: "refs/heads/fix-version"}
+			Expect(clip.UpstreamState(tracked, refs, remotes)).To(Equal(clip.UpstreamOK))
+		})
+		It("Should return gone if the upstream was deleted", func() {
+			tracked := &clip.TrackedBranch{Remote: "origin", Merge: "refs/heads/fix-me-local"}
+			Expect(clip.UpstreamState(tracked, refs, remotes)).To(Equal(clip.UpstreamGone))
+		})
+		It("Should return remote-missing if the remote is not configured", func() {
+			tracked := &clip.TrackedBranch{Remote: "fork", Merge: "refs/heads/master"}
+			Expect(clip.UpstreamState(tracked, refs, remotes)).To(Equal(clip.UpstreamRemoteMissing))
+		})
+		It("Should return misconfigured if remote or merge is missing", func() {
+			tracked := &clip.TrackedBranch{Remote: "origin"}
+			Expect(clip.UpstreamState(tracked, refs, remotes)).To(Equal(clip.UpstreamMisconfigured))
+			tracked = &clip.TrackedBranch{Merge: "refs/heads/master"}
+			Expect(clip.UpstreamState(tracked, refs, remotes)).To(Equal(clip.UpstreamMisconfigured))
+		})
+		It("Should check local upstreams and ignore untracked branches", func() {
+			Expect(clip.UpstreamState(nil, refs, remotes)).To(Equal(""))
+			tracked := &clip.TrackedBranch{Remote: ".", Merge: "refs/heads/gone"}
+			Expect(clip.UpstreamState(tracked, refs, remotes)).To(Equal(clip.UpstreamGone))
+			tracked = &clip.TrackedBranch{Remote: ".", Merge: "refs/heads/master"}
+			Expect(clip.UpstreamState(tracked, refs, remotes)).To(Equal(clip.UpstreamOK))
+		})
+	})
 })
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/thrawn01/args"
+	"github.com/thrawn01/clip"
+	"github.com/thrawn01/clip/internal/cli"
+)
+
+var (
+	yellow = color.New(color.FgYellow).SprintFunc()
+	red    = color.New(color.FgRed).PrintfFunc()
+)
+
+func main() {
+	parser := args.NewParser(args.Name("clip-local"),
+		args.Desc("Clips local branches that are merged into the trunk or whose upstream is gone"))
+	parser.AddOption("--force").Alias("-f").IsTrue().
+		Help("Don't ask before deleting local branches")
+	parser.AddOption("--include-unmerged").IsTrue().
+		Help("Also delete branches whose upstream is gone but have commits not in the trunk")
+	parser.AddOption("--dry-run").Alias("-n").IsTrue().
+		Help("Only list the branches that would be deleted")
+	parser.AddOption("prefix").Default("").Alias("-p").
+		Help("Attempt to prune only branches with this prefix." +
+			" IE: '-p thrawn' will prune 'thrawn/dev' and 'thrawn/clip' branches")
+	parser.AddOption("--show-protected").IsTrue().
+		Help("List the branches kept by 'clip.protect' or .clip.yml protect rules")
+	parser.AddOption("--trunk").Alias("-t").Default("").
+		Help("The branch other branches must be merged into, defaults to" +
+			" 'clip.trunk' from git config or the branch the remote HEAD points to")
+
+	argv := cli.SplitArgs(os.Args[1:])
+	opts := parser.ParseOrExit(&argv)
+
+	backend, err := clip.NewNativeBackend("")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+
+	// Stop analyzing branches on Ctrl-C
+	ctx := cli.CancelOnInterrupt(context.Background())
+
+	repo := clip.NewRepository(backend)
+	if err := run(ctx, repo, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func run(ctx context.Context, repo *clip.Repository, opts *args.Options) error {
+	current, err := repo.CurrentBranch()
+	if err != nil {
+		return err
+	}
+
+	policy, err := repo.LoadPolicy()
+	if err != nil {
+		return err
+	}
+
+	report, err := repo.Analyze(ctx, clip.AnalyzeOpts{Trunk: opts.String("trunk")})
+	if err != nil {
+		return err
+	}
+
+	protected := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer protected.Flush()
+
+	var deleted []*clip.BranchDetail
+
+	for _, branch := range report.Branches {
+		// Never delete the trunk or the branch we are on
+		if branch == report.Trunk || branch.Name == current {
+			continue
+		}
+
+		// Is this branch name prefixed with something?
+		if prefix := opts.String("prefix"); prefix != "" {
+			if !strings.HasPrefix(branch.Name, prefix) {
+				continue
+			}
+		}
+
+		if branch.Err != nil {
+			fmt.Fprintf(os.Stderr, "skipping '%s': %s\n", branch.Name, branch.Err)
+			continue
+		}
+
+		// Only branches merged into trunk or whose upstream was deleted from the remote
+		gone := branch.Upstream == clip.UpstreamGone && branch.Tracked.Remote != "."
+		if branch.Merged == "" && !gone {
+			continue
+		}
+
+		// Never delete a branch checked out in another worktree
+		if branch.Worktree != nil {
+			fmt.Fprintf(os.Stderr, "skipping '%s': checked out in worktree '%s'\n",
+				branch.Name, branch.Worktree.Path)
+			continue
+		}
+
+		reason := fmt.Sprintf("merged (%s)", branch.Merged)
+		if branch.Merged == "" {
+			reason = fmt.Sprintf("upstream gone, %d commits not in the trunk", branch.Trunk.Ahead)
+		}
+
+		// Never delete branches matching a protect rule
+		if rule := policy.Protected(branch.Name); rule != nil {
+			if opts.Bool("show-protected") {
+				fmt.Fprintf(protected, "%s\t%s\t%s\n", branch.Name, rule.Pattern, rule.Source)
+			}
+			continue
+		}
+		if opts.Bool("show-protected") {
+			continue
+		}
+
+		// A gone upstream alone is not enough to lose commits not on the trunk
+		if branch.Merged == "" && !opts.Bool("include-unmerged") {
+			fmt.Fprintf(os.Stderr, "skipping '%s': %s, see --include-unmerged\n", branch.Name, reason)
+			continue
+		}
+
+		if opts.Bool("dry-run") {
+			fmt.Printf("Would delete '%s' %s\n", branch.Name, reason)
+			continue
+		}
+
+		if !opts.Bool("force") {
+			// Branches with commits not on the trunk are kept unless asked otherwise
+			answer := "Y"
+			if branch.Merged == "" {
+				answer = "N"
+			}
+			msg := "Delete Local Branch '%s' %s"
+			if !clip.YesNo(clip.Opts{Default: answer}, msg, branch.Name, reason) {
+				continue
+			}
+		}
+
+		deleted = append(deleted, branch)
+	}
+
+	// Print the sha of each branch so a branch deleted by mistake can be recreated
+	var failed int
+	for _, branch := range deleted {
+		fmt.Printf("Deleting %s (was %s)..\n", yellow(branch.Name), branch.Sha[:12])
+		if err := repo.DeleteLocalBranch(branch.Name); err != nil {
+			failed++
+			red("Failed %s: %s\n", branch.Name, err)
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("failed to delete %d of %d branches", failed, len(deleted))
+	}
+	return nil
+}
@@ -1,22 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
-	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/thrawn01/args"
 	"github.com/thrawn01/clip"
+	"github.com/thrawn01/clip/internal/cli"
 )
 
 var yellow = color.New(color.FgYellow).PrintfFunc()
+var red = color.New(color.FgRed).PrintfFunc()
 
 func main() {
-	refs := clip.BranchReferenceMap{}
-	tracked := clip.TrackedBranchMap{}
-
 	parser := args.NewParser(args.Name("clip-remote"),
 		args.Desc("Clips remote branches that no longer are used locally"))
 	parser.AddOption("--force").Alias("-f").IsTrue().
@@ -24,73 +24,339 @@ func main() {
 	parser.AddOption("prefix").Default("").Alias("-p").
 		Help("Attempt to prune only branches with this prefix." +
 			" IE: '-p thrawn' will prune 'thrawn/dev' and 'thrawn/clip' branches")
+	parser.AddOption("--older-than").Default("").
+		Help("Only prune branches whose last commit is older than this age. IE: '90d', '2w' or '1y'")
+	parser.AddOption("--newer-than").Default("").
+		Help("Only prune branches whose last commit is newer than this age")
+	parser.AddOption("--author").Default("").
+		Help("Only prune branches whose commits are all by this author email, or authors" +
+			" matching a regular expression wrapped in slashes. IE: '/^Derrick/'")
+	parser.AddOption("--mine").IsTrue().
+		Help("Only prune branches whose commits are all authored by 'user.email'")
+	parser.AddOption("--merged").IsTrue().
+		Help("Only prune branches whose commits are in the trunk or are patch equivalent")
+	parser.AddOption("--merged-into").Default("").
+		Help("Only prune branches merged into this branch instead of the trunk")
+	parser.AddOption("--unmerged").IsTrue().
+		Help("Only prune branches with commits the trunk, or --merged-into, does not have")
+	parser.AddOption("--trunk").Alias("-t").Default("").
+		Help("The trunk used by --merged, --unmerged, --author and --mine, defaults to" +
+			" 'clip.trunk' from git config or the branch the remote HEAD points to")
+	parser.AddOption("--dry-run").Alias("-n").IsTrue().
+		Help("Print the branches that would be deleted without deleting them")
+	parser.AddOption("--plan-file").Default("").
+		Help("Write the branches that would be deleted to this file as JSON" +
+			" without deleting them, to be deleted later with --apply")
+	parser.AddOption("--apply").Default("").
+		Help("Delete exactly the branches in this plan file, refusing if any have changed")
+	parser.AddOption("--undo").Default("").
+		Help("Recreate the remote branch deleted by this journal id, or the last deleted" +
+			" branch with '--undo --last'")
+	parser.AddOption("--show-protected").IsTrue().
+		Help("List the branches kept by 'clip.protect' or .clip.yml protect rules")
+	parser.AddOption("--interactive").Alias("-i").IsTrue().
+		Help("Choose the branches to delete from a full screen list instead of a prompt" +
+			" for each branch, prompts are used if stdout is not a terminal")
+	parser.AddOption("--fetch").IsTrue().
+		Help("Fetch the remote, pruning deleted branches, before choosing branches to delete")
+	parser.AddOption("--batch-size").IsInt().Default("50").
+		Help("The number of branches deleted by each push")
+	parser.AddOption("--no-atomic").IsTrue().
+		Help("Delete the branches of a batch independently instead of all or none")
 	parser.AddArgument("remote").Default("origin").
 		Help("The name of the remote to clip branches from")
 
-	opts := parser.ParseSimple(nil)
-
-	// Get which remote to clip
-	remote := opts.String("remote")
+	argv := undoLast(cli.SplitArgs(os.Args[1:]))
+	opts := parser.ParseSimple(&argv)
 
-	// List remote and local branches
-	if err := clip.ListBranchRefs(refs); err != nil {
+	backend, err := clip.NewNativeBackend("")
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
-	// List tracked local branches
-	if err := clip.ListTrackedBranches(tracked); err != nil {
+	repo := clip.NewRepository(backend)
+	if err := run(repo, opts); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
+	os.Exit(0)
+}
 
-	// Find remote branches that do not have local branches and are not tracked
-	branches, ok := refs[remote]
-	if !ok {
-		fmt.Fprintf(os.Stderr, "No such remote named '%s'", remote)
-		os.Exit(1)
+// printLastFetch prints how long ago 'remote' was fetched on stderr so the output of
+// --dry-run is unchanged
+func printLastFetch(repo *clip.Repository, remote string) error {
+	fetched, err := repo.LastFetch([]string{remote})
+	if err != nil {
+		return err
+	}
+	if when, ok := fetched[remote]; ok {
+		fmt.Fprintf(os.Stderr, "Last fetched %s %s ago\n", remote, clip.FormatAge(time.Since(when)))
+		return nil
 	}
+	fmt.Fprintf(os.Stderr, "Last fetched %s unknown, fetch it with --fetch\n", remote)
+	return nil
+}
 
-	for _, branch := range branches {
-		if branch.Name == "HEAD" {
+// undoLast rewrites `--undo --last` and a trailing `--undo` as `--undo last`
+func undoLast(argv []string) []string {
+	var result []string
+	for idx := 0; idx < len(argv); idx++ {
+		result = append(result, argv[idx])
+		if argv[idx] != "--undo" {
 			continue
 		}
+		if idx+1 == len(argv) || argv[idx+1] == "--last" {
+			result = append(result, "last")
+			idx++
+		}
+	}
+	return result
+}
 
-		// Does this branch exist locally?
-		if clip.ExistsLocally(branch, refs) {
-			continue
+func run(repo *clip.Repository, opts *args.Options) error {
+	if opts.Bool("interactive") && opts.Bool("force") {
+		return fmt.Errorf("--interactive and --force can not be used together")
+	}
+
+	// Recreate a deleted branch from the journal
+	if id := opts.String("undo"); id != "" {
+		entry, err := repo.RestoreRemoteBranch(id)
+		if err != nil {
+			return err
 		}
+		yellow("Restored %s/%s to %s\n", entry.Remote, entry.Branch, entry.Sha)
+		return nil
+	}
 
-		// Is this branch tracking a remote branch?
-		if clip.IsTracked(branch, remote, tracked) {
-			continue
+	// Delete a previously reviewed plan
+	if path := opts.String("apply"); path != "" {
+		plan, err := clip.ReadPlan(path)
+		if err != nil {
+			return err
+		}
+		if err := repo.VerifyPlan(plan); err != nil {
+			return err
 		}
+		return deleteBranches(repo, plan, clipOpts(opts), true)
+	}
 
-		if !clip.ExistsRemotely(branch, remote, refs) {
-			continue
+	remote := opts.String("remote")
+	if opts.Bool("fetch") {
+		if err := cli.FetchRemotes(context.Background(), repo, []string{remote}); err != nil {
+			return err
 		}
+	}
+	if err := printLastFetch(repo, remote); err != nil {
+		return err
+	}
 
-		// Is this branch name prefixed with something?
-		if prefix := opts.String("prefix"); prefix != "" {
-			if !strings.HasPrefix(branch.Name, prefix) {
-				continue
+	planOpts := clip.PlanOpts{
+		Remote: remote,
+		Prefix: opts.String("prefix"),
+	}
+	now := time.Now()
+	if age := opts.String("older-than"); age != "" {
+		duration, err := clip.ParseAge(age)
+		if err != nil {
+			return err
+		}
+		planOpts.OlderThan = now.Add(-duration)
+	}
+	if age := opts.String("newer-than"); age != "" {
+		duration, err := clip.ParseAge(age)
+		if err != nil {
+			return err
+		}
+		planOpts.NewerThan = now.Add(-duration)
+	}
+
+	author := opts.String("author")
+	if opts.Bool("mine") {
+		if author != "" {
+			return fmt.Errorf("--author and --mine can not be used together")
+		}
+		email, err := repo.UserEmail()
+		if err != nil {
+			return err
+		}
+		author = email
+	}
+	if author != "" {
+		filter, err := clip.NewAuthorFilter(author)
+		if err != nil {
+			return err
+		}
+		planOpts.Author = filter
+	}
+
+	if opts.Bool("merged") && opts.Bool("unmerged") {
+		return fmt.Errorf("--merged and --unmerged can not be used together")
+	}
+	switch {
+	case opts.Bool("unmerged"):
+		planOpts.Merge = clip.PlanUnmerged
+	case opts.Bool("merged") || opts.String("merged-into") != "":
+		planOpts.Merge = clip.PlanMerged
+	}
+	planOpts.MergedInto = opts.String("merged-into")
+	planOpts.Trunk = opts.String("trunk")
+
+	plan, err := repo.PlanRemoteDeletions(planOpts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Bool("show-protected") {
+		return printProtected(plan)
+	}
+
+	if path := opts.String("plan-file"); path != "" {
+		if err := clip.WritePlan(path, plan); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d branches to '%s'\n", len(plan.Deletions), path)
+	}
+	if opts.Bool("dry-run") {
+		return printPlan(plan)
+	}
+	if opts.String("plan-file") != "" {
+		return nil
+	}
+	if opts.Bool("interactive") {
+		selected, err := selectDeletions(repo, plan, opts.String("trunk"))
+		if err != clip.ErrNoTerminal {
+			if err != nil {
+				return err
 			}
+			plan.Deletions = selected
+			return deleteBranches(repo, plan, clipOpts(opts), true)
 		}
+	}
+	return deleteBranches(repo, plan, clipOpts(opts), opts.Bool("force"))
+}
+
+func clipOpts(opts *args.Options) clip.ClipOpts {
+	return clip.ClipOpts{
+		BatchSize: opts.Int("batch-size"),
+		NoAtomic:  opts.Bool("no-atomic"),
+	}
+}
+
+// printPlan lists the branches in the plan along with the last commit of each
+func printPlan(plan *clip.Plan) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, deletion := range plan.Deletions {
+		var date string
+		if !deletion.Date.IsZero() {
+			date = deletion.Date.Format("2006-01-02")
+		}
+		fmt.Fprintf(writer, "%s/%s\t%s\t%s\t%s\t%s\n", deletion.Remote, deletion.Branch,
+			deletion.Sha[:12], date, deletion.Author, deletion.Reason)
+	}
+	return writer.Flush()
+}
+
+// printProtected lists the branches that would be deleted if not for a protect rule
+func printProtected(plan *clip.Plan) error {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, protected := range plan.Protected {
+		fmt.Fprintf(writer, "%s/%s\t%s\t%s\n", protected.Remote, protected.Branch,
+			protected.Pattern, protected.Source)
+	}
+	return writer.Flush()
+}
+
+// selectDeletions lets the user choose which of the planned branches to delete from a full
+// screen list, ErrNoTerminal is returned if there is no terminal to show it on
+func selectDeletions(repo *clip.Repository, plan *clip.Plan, trunkName string) ([]clip.Deletion, error) {
+	if len(plan.Deletions) == 0 {
+		return nil, nil
+	}
+	items := make([]clip.SelectItem, len(plan.Deletions))
+	byName := map[string]clip.Deletion{}
+	for idx, deletion := range plan.Deletions {
+		name := deletion.Remote + "/" + deletion.Branch
+		items[idx] = clip.SelectItem{Name: name, Date: deletion.Date, Author: deletion.Author}
+		byName[name] = deletion
+	}
 
-		if !opts.Bool("force") {
+	// Show how far each branch is from the trunk when there is one
+	refs := clip.BranchReferenceMap{}
+	if err := repo.ListBranchRefs(refs); err != nil {
+		return nil, err
+	}
+	if trunk, err := repo.ResolveTrunk(trunkName, refs); err == nil {
+		var pairs []clip.RevPair
+		for _, deletion := range plan.Deletions {
+			pairs = append(pairs, clip.RevPair{Branch: deletion.Sha, Base: trunk.Sha})
+		}
+		counts := clip.AheadBehindMap{}
+		if err := repo.AheadBehind(counts, pairs); err != nil {
+			return nil, err
+		}
+		for idx := range items {
+			count := counts[pairs[idx]]
+			items[idx].Counts = &count
+		}
+	}
+
+	selected, err := clip.Select("Delete branches from "+plan.Remote, items)
+	if err != nil {
+		return nil, err
+	}
+	var deletions []clip.Deletion
+	for _, item := range selected {
+		deletions = append(deletions, byName[item.Name])
+	}
+	return deletions, nil
+}
+
+func deleteBranches(repo *clip.Repository, plan *clip.Plan, opts clip.ClipOpts, force bool) error {
+	var approved []clip.Deletion
+	for _, deletion := range plan.Deletions {
+		if !force {
 			// Ask if we should delete this remote branch
 			msg := "Delete Remote Branch '%s/%s'"
-			if !clip.YesNo(clip.Opts{Default: "Y"}, msg, remote, branch.Name) {
+			answer := "Y"
+			if deletion.Ahead != 0 {
+				// Branches with commits that are not merged are kept unless asked otherwise
+				msg += fmt.Sprintf(" with %d unmerged commits", deletion.Ahead)
+				answer = "N"
+			}
+			if !clip.YesNo(clip.Opts{Default: answer}, msg, deletion.Remote, deletion.Branch) {
 				continue
 			}
 		}
+		approved = append(approved, deletion)
+	}
+	if len(approved) == 0 {
+		return nil
+	}
+
+	yellow("Deleting %d branches..\n", len(approved))
+	// Delete remote branches and record them in the journal
+	results, err := repo.ClipRemoteBranches(approved, opts)
+	if err != nil {
+		return err
+	}
 
-		yellow("Deleting %s/%s..\n", remote, branch.Name)
-		// Delete remote branch
-		if err := exec.Command("git", "push", remote, "--delete", branch.Name).Run(); err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
+	var failed int
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			red("Failed %s/%s: %s\n", result.Deletion.Remote, result.Deletion.Branch, result.Err)
+			continue
+		}
+		fmt.Printf("Deleted %s/%s, undo with 'git clip-remote --undo %d'\n",
+			result.Deletion.Remote, result.Deletion.Branch, result.Entry.ID)
+		if result.AnchorErr != nil {
+			yellow("Warning: %s; the commits of %s/%s may be garbage collected before undo\n",
+				result.AnchorErr, result.Deletion.Remote, result.Deletion.Branch)
 		}
 	}
-	os.Exit(0)
+	if failed != 0 {
+		return fmt.Errorf("failed to delete %d of %d branches", failed, len(results))
+	}
+	return nil
 }
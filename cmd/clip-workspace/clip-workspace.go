@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/thrawn01/args"
+	"github.com/thrawn01/clip"
+	"github.com/thrawn01/clip/internal/cli"
+)
+
+var (
+	yellow = color.New(color.FgYellow).SprintFunc()
+	red    = color.New(color.FgRed).SprintFunc()
+)
+
+func main() {
+	parser := args.NewParser(args.Name("clip-workspace"),
+		args.Desc("Summarize the branches of every git repository in a directory"))
+	parser.AddOption("--manifest").Alias("-m").Default("").
+		Help("Scan the repositories listed under 'repos:' in this YAML file instead of" +
+			" searching the directory, paths are relative to the manifest")
+	parser.AddOption("--workers").Alias("-w").IsInt().Default("0").
+		Help("Number of repositories to analyze at once, defaults to the number of CPUs")
+	parser.AddArgument("dir").Default(".").
+		Help("The directory to search for git repositories")
+
+	argv := cli.SplitArgs(os.Args[1:])
+	opts := parser.ParseOrExit(&argv)
+
+	// Stop analyzing repositories on Ctrl-C
+	ctx := cli.CancelOnInterrupt(context.Background())
+
+	if err := run(ctx, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, opts *args.Options) error {
+	root := opts.String("dir")
+	var paths []string
+	var err error
+	if manifest := opts.String("manifest"); manifest != "" {
+		root = filepath.Dir(manifest)
+		paths, err = clip.ReadManifest(manifest)
+	} else {
+		var skipped []error
+		paths, skipped, err = clip.FindRepositories(root)
+		for _, skip := range skipped {
+			fmt.Fprintf(os.Stderr, "skipping: %s\n", skip)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no git repositories found in '%s'", root)
+	}
+
+	fmt.Fprintf(os.Stderr, "Scanning %d repositories..\n", len(paths))
+	repos := clip.ScanWorkspace(ctx, paths, clip.WorkspaceOpts{Workers: opts.Int("workers")})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Show paths relative to the workspace
+	for _, repo := range repos {
+		if rel, err := filepath.Rel(root, repo.Path); err == nil {
+			repo.Path = rel
+		}
+	}
+
+	var unpushed, behind, prunable, failed int
+	printGroup("Unpushed work", repos, func(repo *clip.WorkspaceRepo) string {
+		if repo.Err != nil || len(repo.Unpushed) == 0 {
+			return ""
+		}
+		unpushed++
+		return strings.Join(repo.Unpushed, ", ")
+	})
+	printGroup("Behind trunk", repos, func(repo *clip.WorkspaceRepo) string {
+		if repo.Err != nil || len(repo.Behind) == 0 {
+			return ""
+		}
+		behind++
+		var names []string
+		for _, count := range repo.Behind {
+			names = append(names, fmt.Sprintf("%s (%d)", count.Name, count.Behind))
+		}
+		return fmt.Sprintf("%s behind %s", strings.Join(names, ", "), repo.Trunk)
+	})
+	printGroup("Prunable", repos, func(repo *clip.WorkspaceRepo) string {
+		if repo.Err != nil || len(repo.Prunable) == 0 {
+			return ""
+		}
+		prunable++
+		return strings.Join(repo.Prunable, ", ")
+	})
+	printGroup("Errors", repos, func(repo *clip.WorkspaceRepo) string {
+		if repo.Err != nil {
+			failed++
+			return red(repo.Err.Error())
+		}
+		if len(repo.Failed) == 0 {
+			return ""
+		}
+		failed++
+		var reasons []string
+		for _, branch := range repo.Failed {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", branch.Name, branch.Err))
+		}
+		return red(strings.Join(reasons, "; "))
+	})
+
+	fmt.Printf("Scanned %d repositories; %d with unpushed work, %d with branches behind the"+
+		" trunk, %d with prunable branches\n", len(repos), unpushed, behind, prunable)
+	if failed != 0 {
+		return fmt.Errorf("failed to analyze %d repositories", failed)
+	}
+	return nil
+}
+
+// printGroup prints the repositories for which 'line' returns a non empty line under
+// 'title', nothing is printed if there are none
+func printGroup(title string, repos []*clip.WorkspaceRepo, line func(*clip.WorkspaceRepo) string) {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	var found bool
+	for _, repo := range repos {
+		text := line(repo)
+		if text == "" {
+			continue
+		}
+		if !found {
+			fmt.Println(title)
+			found = true
+		}
+		fmt.Fprintf(writer, "  %s\t%s\n", yellow(repo.Path), text)
+	}
+	writer.Flush()
+	if found {
+		fmt.Println("")
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"sort"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
-	"github.com/pkg/errors"
+	"github.com/thrawn01/args"
 	"github.com/thrawn01/clip"
+	"github.com/thrawn01/clip/internal/cli"
 )
 
 var (
@@ -16,51 +20,22 @@ var (
 	green  = color.New(color.FgGreen).PrintfFunc()
 )
 
-func aheadBehind(output *string, master, branch string) error {
-	var ahead, behind []string
-	if err := clip.CommitsBetween(&ahead, master, branch); err != nil {
-		return errors.Wrap(err, "aheadBehind() - ahead")
-	}
-	if err := clip.CommitsBetween(&behind, branch, master); err != nil {
-		return errors.Wrap(err, "aheadBehind() - ahead")
-	}
-	*output = fmt.Sprintf(" (%d/%d)", len(ahead), len(behind))
-	return nil
-}
-
-func sortBranches(details clip.BranchDetailMap) []string {
-	var sortedBranches []string
-	for key := range details {
-		sortedBranches = append(sortedBranches, key)
-	}
-	sort.Strings(sortedBranches)
-	return sortedBranches
-}
-
 func printRemotes(branch *clip.BranchDetail) {
 	for _, remote := range branch.Remotes {
 		if remote == nil {
 			continue
 		}
 
-		var commits []string
 		fmt.Printf("     %s ", remote.Ref)
+		count := branch.RemoteCounts[remote.Ref]
 		// Commits Behind
-		if err := clip.CommitsBetween(&commits, remote.Sha, branch.Sha); err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
-		}
-		if len(commits) != 0 {
-			green("is %d commits behind\n", len(commits))
+		if count.Ahead != 0 {
+			green("is %d commits behind\n", count.Ahead)
 			continue
 		}
 		// Commits Ahead
-		if err := clip.CommitsBetween(&commits, branch.Sha, remote.Sha); err != nil {
-			fmt.Fprintln(os.Stderr, err.Error())
-			os.Exit(1)
-		}
-		if len(commits) != 0 {
-			red("is %d commits ahead\n", len(commits))
+		if count.Behind != 0 {
+			red("is %d commits ahead\n", count.Behind)
 			continue
 		}
 		fmt.Println("")
@@ -68,45 +43,390 @@ func printRemotes(branch *clip.BranchDetail) {
 }
 
 func main() {
-	trackedBranches := clip.TrackedBranchMap{}
-	branchRefs := clip.BranchReferenceMap{}
-	details := clip.BranchDetailMap{}
+	parser := args.NewParser(args.Name("clip"),
+		args.Desc("Show the state of all your git branches at a glance"))
+	parser.AddOption("--workers").Alias("-w").IsInt().Default("0").
+		Help("Number of branches to analyze at once, defaults to the number of CPUs")
+	parser.AddOption("--trunk").Alias("-t").Default("").
+		Help("The branch all other branches are compared against, defaults to" +
+			" 'clip.trunk' from git config or the branch the remote HEAD points to")
+	parser.AddOption("--base").Alias("-b").IsStringSlice().
+		Help("Also compare branches against these comma separated bases" +
+			" IE: '-b origin/main,release/2.4', defaults to 'clip.base' from git config")
+	parser.AddOption("--format").Alias("-o").Default("text").
+		Help("Output format, one of 'text', 'json' or 'ndjson' (one branch per line)")
+	parser.AddOption("--interactive").Alias("-i").IsTrue().
+		Help("Choose local branches to delete from a full screen list, or by answering a" +
+			" prompt for each branch if stdout is not a terminal")
+	parser.AddOption("--fetch").Alias("-f").IsTrue().
+		Help("Fetch all remotes at once, pruning deleted branches, before the report")
+	parser.AddOption("--porcelain").Default("").
+		Help("Output in a stable tab separated format for scripts, the only version is 'v1'")
 
-	// List Tracked Branches
-	if err := clip.ListTrackedBranches(trackedBranches); err != nil {
+	argv := cli.SplitArgs(os.Args[1:])
+	opts := parser.ParseOrExit(&argv)
+
+	backend, err := clip.NewNativeBackend("")
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 
-	// List All Branches organized by remote
-	if err := clip.ListBranchRefs(branchRefs); err != nil {
+	// Stop analyzing branches on Ctrl-C
+	ctx := cli.CancelOnInterrupt(context.Background())
+
+	repo := clip.NewRepository(backend)
+	if err := run(ctx, repo, opts); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
+}
 
-	// Collect all the branch information so it's simple to display
-	if err := clip.MergeBranchDetail(details, branchRefs, trackedBranches); err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
-		os.Exit(1)
+func run(ctx context.Context, repo *clip.Repository, opts *args.Options) error {
+	// Cancelled if writing a streamed result fails, there is no one left to read the rest
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var writeErr error
+
+	analyzeOpts := clip.AnalyzeOpts{
+		Workers: opts.Int("workers"),
+		Trunk:   opts.String("trunk"),
+		Bases:   opts.StringSlice("base"),
 	}
 
-	// Display a sorted list of branch information to the user
-	for _, name := range sortBranches(details) {
-		branch := details[name]
+	format := opts.String("format")
+	if version := opts.String("porcelain"); version != "" {
+		if version != clip.PorcelainVersion {
+			return fmt.Errorf("unknown porcelain version '%s'; expected '%s'",
+				version, clip.PorcelainVersion)
+		}
+		if opts.WasSeen("format") {
+			return fmt.Errorf("--porcelain can not be used with --format")
+		}
+		format = "porcelain"
+	}
+
+	if opts.Bool("interactive") && format != "text" {
+		return fmt.Errorf("--interactive can not be used with the '%s' format", format)
+	}
+
+	remotes, err := repo.ListRemotes()
+	if err != nil {
+		return err
+	}
+	if opts.Bool("fetch") {
+		if err := cli.FetchRemotes(ctx, repo, clip.SortedRemotes(remotes)); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case "text":
+		if err := printLastFetch(repo, clip.SortedRemotes(remotes)); err != nil {
+			return err
+		}
+	case "json":
+	case "porcelain":
+		analyzeOpts.OnResult = func(report *clip.Report, branch *clip.BranchDetail) {
+			if ctx.Err() != nil && branch.Err == ctx.Err() {
+				return
+			}
+			if writeErr != nil {
+				return
+			}
+			if err := clip.WritePorcelain(os.Stdout, branch, report.Trunk); err != nil {
+				writeErr = err
+				cancel()
+			}
+		}
+	case "ndjson":
+		// Write each branch as soon as it's analyzed
+		encoder := json.NewEncoder(os.Stdout)
+		analyzeOpts.OnResult = func(report *clip.Report, branch *clip.BranchDetail) {
+			if ctx.Err() != nil && branch.Err == ctx.Err() {
+				return
+			}
+			line := clip.NewJSONBranch(branch, report.Trunk)
+			line.Version = clip.JSONVersion
+			if writeErr != nil {
+				return
+			}
+			if err := encoder.Encode(line); err != nil {
+				writeErr = err
+				cancel()
+			}
+		}
+	default:
+		return fmt.Errorf("unknown format '%s'; expected 'text', 'json' or 'ndjson'", format)
+	}
+
+	report, err := repo.Analyze(ctx, analyzeOpts)
+	if writeErr != nil {
+		return writeErr
+	}
+	if report == nil {
+		return err
+	}
+
+	var failed int
+	for _, branch := range report.Branches {
+		if branch.Err != nil && branch.Err != err {
+			failed++
+		}
+	}
+
+	if opts.Bool("interactive") {
+		if err != nil {
+			return err
+		}
+		return deleteInteractive(repo, report)
+	}
+
+	switch format {
+	case "text":
+		printText(report, err)
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(clip.NewJSONReport(report)); err != nil {
+			return err
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	if failed != 0 {
+		return fmt.Errorf("failed to analyze %d branches", failed)
+	}
+	return nil
+}
+
+// printLastFetch prints how long ago each of 'remotes' was fetched
+func printLastFetch(repo *clip.Repository, remotes []string) error {
+	if len(remotes) == 0 {
+		return nil
+	}
+	fetched, err := repo.LastFetch(remotes)
+	if err != nil {
+		return err
+	}
+	var ages []string
+	for _, remote := range remotes {
+		when, ok := fetched[remote]
+		if !ok {
+			ages = append(ages, remote+" unknown")
+			continue
+		}
+		ages = append(ages, fmt.Sprintf("%s %s ago", remote, clip.FormatAge(time.Since(when))))
+	}
+	fmt.Printf("Last fetched %s\n", strings.Join(ages, ", "))
+	return nil
+}
+
+// printText displays the branches in the order they were reported, 'err' is the error
+// returned with the report if analysis was interrupted
+func printText(report *clip.Report, err error) {
+	if head := report.Head; head != nil && head.Detached() && head.Sha != "" {
+		fmt.Printf("HEAD detached at %s", yellow(head.Sha[:12]))
+		if len(head.Tags) != 0 {
+			fmt.Printf(" (%s)", strings.Join(head.Tags, ", "))
+		}
+		fmt.Println("")
+	}
+
+	for _, branch := range report.Branches {
 		var follow, tracked string
+		// Mark the branch checked out like `git branch` does
+		marker := "  "
+		if branch.Worktree != nil && branch.Worktree.Current {
+			marker = "* "
+		}
 
+		// Branches not analyzed before we were interrupted
+		if err != nil && branch.Err == err {
+			continue
+		}
 		if branch.Tracked != nil {
 			tracked = fmt.Sprintf(" [%s]", branch.Tracked.Remote)
 		}
-		if name != "_trunk_" {
-			if err := aheadBehind(&follow, details["_trunk_"].Sha, branch.Sha); err != nil {
-				fmt.Fprintln(os.Stderr, err.Error())
-				os.Exit(1)
-			}
+		if branch.Err != nil {
+			fmt.Printf("%s%s%s ", marker, yellow(branch.Name), tracked)
+			red("error: %s\n", branch.Err)
+			continue
+		}
+		if branch != report.Trunk {
+			follow = fmt.Sprintf(" (%d/%d)", branch.Trunk.Ahead, branch.Trunk.Behind)
+		}
+		// Counts against each of the bases follow in the order they were given
+		for _, base := range branch.Bases {
+			follow += fmt.Sprintf(" %s (%d/%d)", base.Base, base.Ahead, base.Behind)
 		}
 		// Print the branch name and the remote it's tracking
-		fmt.Printf("%s%s%s\n", yellow(branch.Name), follow, tracked)
+		fmt.Printf("%s%s%s%s", marker, yellow(branch.Name), follow, tracked)
+		// A gone upstream usually means the branch was merged and deleted on the server
+		switch branch.Upstream {
+		case clip.UpstreamGone:
+			red(" upstream gone")
+		case clip.UpstreamRemoteMissing:
+			red(" remote '%s' missing", branch.Tracked.Remote)
+		case clip.UpstreamMisconfigured:
+			red(" upstream misconfigured")
+		}
+		if worktree := branch.Worktree; worktree != nil {
+			if !worktree.Current {
+				fmt.Printf(" worktree %s", worktree.Path)
+			}
+			if worktree.StatusErr != nil {
+				red(" (status unknown)")
+			} else if worktree.Dirty {
+				red(" (%s)", statusText(worktree.Status))
+			}
+		}
+		if count := len(branch.Stashes); count != 0 {
+			fmt.Printf(" %s", plural(count, "stash", "stashes"))
+		}
+		// Commits added by a squash or rebase merge are still counted, so say it's merged
+		if branch.Merged != "" && branch.Merged != clip.MergedAncestor {
+			green(" merged (%s)", branch.Merged)
+		}
+		fmt.Println("")
 		// Print all the remotes associated with this branch
 		printRemotes(branch)
 	}
+
+	// Stashes made with HEAD detached or on branches since deleted
+	for _, stash := range report.Stashes {
+		branch := stash.Branch
+		if branch == "" {
+			branch = "detached HEAD"
+		}
+		fmt.Printf("%s on %s: %s\n", yellow(stash.Ref), branch, stash.Message)
+	}
+}
+
+// statusText describes the changes in a worktree like '2 staged, 1 untracked'
+func statusText(status clip.StatusCounts) string {
+	var parts []string
+	for _, count := range []struct {
+		count int
+		name  string
+	}{
+		{status.Staged, "staged"},
+		{status.Unstaged, "unstaged"},
+		{status.Untracked, "untracked"},
+	} {
+		if count.count != 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count.count, count.name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// plural returns 'count' followed by 'one' or 'many'
+func plural(count int, one, many string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, one)
+	}
+	return fmt.Sprintf("%d %s", count, many)
+}
+
+// deleteInteractive lets the user choose which local branches to delete, the trunk, the
+// current branch, branches checked out in other worktrees and protected branches are
+// never offered. Branches with commits not in the trunk must be confirmed on their own and
+// a branch that fails to delete doesn't stop the rest.
+func deleteInteractive(repo *clip.Repository, report *clip.Report) error {
+	current, err := repo.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	policy, err := repo.LoadPolicy()
+	if err != nil {
+		return err
+	}
+
+	var branches []*clip.BranchDetail
+	var shas []string
+	for _, branch := range report.Branches {
+		if branch == report.Trunk || branch.Name == current || branch.Err != nil {
+			continue
+		}
+		if branch.Worktree != nil {
+			continue
+		}
+		if policy.Protected(branch.Name) != nil {
+			continue
+		}
+		branches = append(branches, branch)
+		shas = append(shas, branch.Sha)
+	}
+	if len(branches) == 0 {
+		fmt.Println("No branches to delete")
+		return nil
+	}
+
+	// Show the age and author of the last commit of each branch
+	commits := map[string]*clip.Commit{}
+	if err := repo.LookupCommits(commits, shas); err != nil {
+		return err
+	}
+	items := make([]clip.SelectItem, len(branches))
+	for idx, branch := range branches {
+		count := branch.Trunk
+		items[idx] = clip.SelectItem{Name: branch.Name, Counts: &count}
+		if commit, ok := commits[branch.Sha]; ok {
+			items[idx].Date = commit.Committer.When
+			items[idx].Author = commit.Author.Name
+		}
+	}
+
+	byName := map[string]*clip.BranchDetail{}
+	for _, branch := range branches {
+		byName[branch.Name] = branch
+	}
+
+	var chosen []*clip.BranchDetail
+	selected, err := clip.Select("Delete local branches", items)
+	switch err {
+	case nil:
+		for _, item := range selected {
+			branch := byName[item.Name]
+			// Selecting from the list is not enough to lose commits not on the trunk
+			if branch.Merged == "" {
+				msg := "'%s' has %d commits not in the trunk, delete it anyway"
+				if !clip.YesNo(clip.Opts{Default: "N"}, msg, branch.Name, branch.Trunk.Ahead) {
+					continue
+				}
+			}
+			chosen = append(chosen, branch)
+		}
+	case clip.ErrNoTerminal:
+		for _, branch := range branches {
+			// Branches with commits not on the trunk are kept unless asked otherwise
+			answer := "Y"
+			if branch.Merged == "" {
+				answer = "N"
+			}
+			msg := "Delete Local Branch '%s' (%d/%d)"
+			if clip.YesNo(clip.Opts{Default: answer}, msg, branch.Name, branch.Trunk.Ahead, branch.Trunk.Behind) {
+				chosen = append(chosen, branch)
+			}
+		}
+	default:
+		return err
+	}
+
+	// Print the sha of each branch so a branch deleted by mistake can be recreated
+	var failed int
+	for _, branch := range chosen {
+		fmt.Printf("Deleting %s (was %s)..\n", yellow(branch.Name), branch.Sha[:12])
+		if err := repo.DeleteLocalBranch(branch.Name); err != nil {
+			failed++
+			red("Failed %s: %s\n", branch.Name, err)
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("failed to delete %d of %d branches", failed, len(chosen))
+	}
+	return nil
 }
@@ -0,0 +1,217 @@
+package clip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	graphParentNone  = 0x70000000
+	graphExtraEdges  = 0x80000000
+	graphLastEdge    = 0x80000000
+	graphHeaderSize  = 8
+	graphChunkSize   = 12
+	graphCommitSize  = 36
+	graphMaxPosition = 0x7fffffff
+)
+
+// commitGraph is a single commit-graph file or every layer of a commit-graph chain
+type commitGraph struct {
+	layers []*graphLayer
+}
+
+// graphLayer is one commit-graph file, positions of commits in the layer are offset by
+// the number of commits in all the base layers before it
+type graphLayer struct {
+	base    uint32
+	fanout  [256]uint32
+	ids     []byte
+	commits []byte
+	edges   []byte
+}
+
+// openCommitGraph loads `commit-graph` or the `commit-graphs/commit-graph-chain` from the
+// objects `info` directory. It returns nil if the repository has no commit-graph.
+func openCommitGraph(infoDir string) (*commitGraph, error) {
+	var files []string
+	if _, err := os.Stat(filepath.Join(infoDir, "commit-graph")); err == nil {
+		files = append(files, filepath.Join(infoDir, "commit-graph"))
+	} else {
+		chain, err := ioutil.ReadFile(filepath.Join(infoDir, "commit-graphs", "commit-graph-chain"))
+		if err != nil {
+			return nil, nil
+		}
+		for _, hash := range strings.Fields(string(chain)) {
+			files = append(files, filepath.Join(infoDir, "commit-graphs", "graph-"+hash+".graph"))
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	graph := &commitGraph{}
+	var base uint32
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "openCommitGraph()")
+		}
+		layer, err := parseGraphLayer(content, base)
+		if err != nil {
+			return nil, errors.Wrapf(err, "while reading '%s'", file)
+		}
+		graph.layers = append(graph.layers, layer)
+		base += layer.fanout[255]
+	}
+	return graph, nil
+}
+
+func parseGraphLayer(content []byte, base uint32) (*graphLayer, error) {
+	if len(content) < graphHeaderSize || !bytes.Equal(content[:4], []byte("CGPH")) {
+		return nil, errors.New("not a commit-graph file")
+	}
+	if content[4] != 1 {
+		return nil, errors.Errorf("unsupported commit-graph version %d", content[4])
+	}
+	if content[5] != 1 {
+		return nil, errors.New("unsupported commit-graph hash version")
+	}
+
+	chunks := map[string][]byte{}
+	count := int(content[6])
+	if len(content) < graphHeaderSize+(count+1)*graphChunkSize {
+		return nil, errors.New("commit-graph chunk table is truncated")
+	}
+	for i := 0; i < count; i++ {
+		entry := content[graphHeaderSize+i*graphChunkSize:]
+		next := content[graphHeaderSize+(i+1)*graphChunkSize:]
+		start := binary.BigEndian.Uint64(entry[4:12])
+		end := binary.BigEndian.Uint64(next[4:12])
+		if start > end || end > uint64(len(content)) {
+			return nil, errors.New("commit-graph chunk offset out of range")
+		}
+		chunks[string(entry[:4])] = content[start:end]
+	}
+
+	layer := &graphLayer{
+		base:    base,
+		ids:     chunks["OIDL"],
+		commits: chunks["CDAT"],
+		edges:   chunks["EDGE"],
+	}
+	fanout := chunks["OIDF"]
+	if len(fanout) != 256*4 {
+		return nil, errors.New("commit-graph fanout chunk is missing")
+	}
+	for i := 0; i < 256; i++ {
+		layer.fanout[i] = binary.BigEndian.Uint32(fanout[i*4:])
+	}
+	total := int(layer.fanout[255])
+	if len(layer.ids) < total*20 || len(layer.commits) < total*graphCommitSize {
+		return nil, errors.New("commit-graph is truncated")
+	}
+	return layer, nil
+}
+
+// find returns the position of 'id' in the graph
+func (g *commitGraph) find(id []byte) (uint32, bool) {
+	for _, layer := range g.layers {
+		low := 0
+		if id[0] > 0 {
+			low = int(layer.fanout[id[0]-1])
+		}
+		high := int(layer.fanout[id[0]])
+		i := low + sort.Search(high-low, func(i int) bool {
+			return bytes.Compare(layer.ids[(low+i)*20:(low+i)*20+20], id) >= 0
+		})
+		if i < high && bytes.Equal(layer.ids[i*20:i*20+20], id) {
+			return layer.base + uint32(i), true
+		}
+	}
+	return 0, false
+}
+
+// layer returns the layer holding the commit at 'pos' and its index within the layer
+func (g *commitGraph) layer(pos uint32) (*graphLayer, int, error) {
+	for i := len(g.layers) - 1; i >= 0; i-- {
+		if pos >= g.layers[i].base {
+			idx := int(pos - g.layers[i].base)
+			if idx >= int(g.layers[i].fanout[255]) {
+				break
+			}
+			return g.layers[i], idx, nil
+		}
+	}
+	return nil, 0, errors.Errorf("commit-graph position %d out of range", pos)
+}
+
+func (g *commitGraph) sha(pos uint32) (string, error) {
+	layer, idx, err := g.layer(pos)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(layer.ids[idx*20 : idx*20+20]), nil
+}
+
+// commit returns the parents, generation number and commit time of 'sha'. 'ok' is false if
+// the commit is not in the graph.
+func (g *commitGraph) commit(sha string) (parents []string, generation uint32, when int64, ok bool, err error) {
+	id, err := hex.DecodeString(sha)
+	if err != nil || len(id) != 20 {
+		return nil, 0, 0, false, nil
+	}
+	pos, ok := g.find(id)
+	if !ok {
+		return nil, 0, 0, false, nil
+	}
+	layer, idx, err := g.layer(pos)
+	if err != nil {
+		return nil, 0, 0, false, err
+	}
+
+	entry := layer.commits[idx*graphCommitSize : (idx+1)*graphCommitSize]
+	first := binary.BigEndian.Uint32(entry[20:24])
+	second := binary.BigEndian.Uint32(entry[24:28])
+	genHigh := binary.BigEndian.Uint32(entry[28:32])
+	generation = genHigh >> 2
+	when = int64(genHigh&3)<<32 | int64(binary.BigEndian.Uint32(entry[32:36]))
+
+	var positions []uint32
+	if first != graphParentNone {
+		positions = append(positions, first)
+	}
+	switch {
+	case second == graphParentNone:
+	case second&graphExtraEdges != 0:
+		// Octopus merges list the second and later parents in the extra edges chunk
+		for i := int(second & graphMaxPosition); ; i++ {
+			if len(layer.edges) < (i+1)*4 {
+				return nil, 0, 0, false, errors.New("commit-graph extra edge out of range")
+			}
+			edge := binary.BigEndian.Uint32(layer.edges[i*4:])
+			positions = append(positions, edge&graphMaxPosition)
+			if edge&graphLastEdge != 0 {
+				break
+			}
+		}
+	default:
+		positions = append(positions, second)
+	}
+
+	for _, position := range positions {
+		parent, err := g.sha(position)
+		if err != nil {
+			return nil, 0, 0, false, err
+		}
+		parents = append(parents, parent)
+	}
+	return parents, generation, when, true, nil
+}
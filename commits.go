@@ -0,0 +1,103 @@
+package clip
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+func (b *ExecBackend) LookupCommits(result map[string]*Commit, shas []string) error {
+	if len(shas) == 0 {
+		return nil
+	}
+	var output string
+	input := strings.Join(shas, "\n") + "\n"
+	if err := b.gitInput(&output, input, "cat-file", "--batch"); err != nil {
+		return errors.Wrap(err, "LookupCommits()")
+	}
+	return ParseCatFileBatch(result, output)
+}
+
+func (b *NativeBackend) LookupCommits(result map[string]*Commit, shas []string) error {
+	store, err := b.Objects()
+	if err == nil {
+		for _, sha := range shas {
+			commit, err := store.ReadCommit(sha)
+			if err != nil {
+				if errors.Cause(err) == ErrObjectNotFound {
+					continue
+				}
+				return err
+			}
+			result[sha] = commit
+		}
+		return nil
+	}
+	return b.ExecBackend.LookupCommits(result, shas)
+}
+
+func (r *Repository) LookupCommits(result map[string]*Commit, shas []string) error {
+	return r.Backend.LookupCommits(result, shas)
+}
+
+// LoadCommits looks up the tip commit of every branch in 'refs' at once and sets
+// Branch.Commit. Branches whose commit is missing are left with a nil Commit.
+func (r *Repository) LoadCommits(refs BranchReferenceMap) error {
+	var shas []string
+	seen := map[string]bool{}
+	for _, branches := range refs {
+		for _, branch := range branches {
+			if !seen[branch.Sha] {
+				seen[branch.Sha] = true
+				shas = append(shas, branch.Sha)
+			}
+		}
+	}
+
+	commits := map[string]*Commit{}
+	if err := r.LookupCommits(commits, shas); err != nil {
+		return err
+	}
+	for _, branches := range refs {
+		for _, branch := range branches {
+			branch.Commit = commits[branch.Sha]
+		}
+	}
+	return nil
+}
+
+// ParseCatFileBatch parses the output of `git cat-file --batch` adding every commit to
+// 'result'. Missing objects and objects which are not commits are skipped.
+func ParseCatFileBatch(result map[string]*Commit, input string) error {
+	for input != "" {
+		idx := strings.IndexByte(input, '\n')
+		if idx == -1 {
+			return errors.Errorf("truncated 'git cat-file' header '%s'", input)
+		}
+		header := strings.Fields(input[:idx])
+		input = input[idx+1:]
+
+		// `<sha> missing` for objects that don't exist
+		if len(header) != 3 {
+			continue
+		}
+		size, err := strconv.Atoi(header[2])
+		if err != nil || size+1 > len(input) {
+			return errors.Errorf("invalid 'git cat-file' header '%s'", strings.Join(header, " "))
+		}
+		data := input[:size]
+		// The contents are followed by a newline
+		input = input[size+1:]
+
+		if header[1] != "commit" {
+			continue
+		}
+		commit, err := ParseCommit(header[0], []byte(data))
+		if err != nil {
+			return err
+		}
+		result[header[0]] = commit
+	}
+	return nil
+}
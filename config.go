@@ -0,0 +1,716 @@
+package clip
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Config holds git config entries keyed by their canonical name. Section and
+// variable names are lower case while subsections retain their case.
+//
+//	config := Config{
+//		"branch.master.remote": []string{"origin"},
+//		"branch.Fix Me.merge": []string{"refs/heads/fix-me"},
+//	}
+type Config map[string][]string
+
+// Get returns the last value for 'key' which is the value git would use
+func (c Config) Get(key string) string {
+	values := c[CanonicalConfigKey(key)]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// GetAll returns all the values for a multi-valued key
+func (c Config) GetAll(key string) []string {
+	return c[CanonicalConfigKey(key)]
+}
+
+func (c Config) Add(key, value string) {
+	key = CanonicalConfigKey(key)
+	c[key] = append(c[key], value)
+}
+
+// CanonicalConfigKey lower cases the section and variable name of 'key'
+func CanonicalConfigKey(key string) string {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first == -1 {
+		return strings.ToLower(key)
+	}
+	if first == last {
+		return strings.ToLower(key)
+	}
+	return strings.ToLower(key[:first]) + key[first:last] + strings.ToLower(key[last:])
+}
+
+// splitConfigKey splits 'key' into section, subsection and variable name
+func splitConfigKey(key string) (section, subsection, name string) {
+	first := strings.Index(key, ".")
+	last := strings.LastIndex(key, ".")
+	if first == -1 {
+		return key, "", ""
+	}
+	if first == last {
+		return key[:first], "", key[last+1:]
+	}
+	return key[:first], key[first+1 : last], key[last+1:]
+}
+
+// ParseConfigList parses the output of `git config --null --list` or
+// `git config --null --get-regexp` into 'result'
+func ParseConfigList(result Config, input string) error {
+	for _, entry := range strings.Split(input, "\x00") {
+		if entry == "" {
+			continue
+		}
+		// A key with no value is a boolean true
+		parts := strings.SplitN(entry, "\n", 2)
+		if len(parts) == 1 {
+			result.Add(parts[0], "true")
+			continue
+		}
+		result.Add(parts[0], parts[1])
+	}
+	return nil
+}
+
+// ParseTrackedConfig fills 'result' with the tracked branches found in the `branch.<name>.*`
+// entries of 'config'. PushRemote is resolved the same way `git push` does, preferring
+// `branch.<name>.pushRemote` then `remote.pushDefault` and finally `branch.<name>.remote`.
+func ParseTrackedConfig(result TrackedBranchMap, config Config) error {
+	for key := range config {
+		section, name, variable := splitConfigKey(key)
+		if section != "branch" || name == "" {
+			continue
+		}
+		tracked, ok := result[name]
+		if !ok {
+			tracked = &TrackedBranch{Name: name}
+		}
+		switch variable {
+		case "remote":
+			tracked.Remote = config.Get(key)
+		case "merge":
+			tracked.Merge = config.Get(key)
+		case "pushremote":
+			tracked.PushRemote = config.Get(key)
+		case "rebase":
+			tracked.Rebase = config.Get(key)
+		default:
+			continue
+		}
+		result[name] = tracked
+	}
+
+	pushDefault := config.Get("remote.pushDefault")
+	for name, tracked := range result {
+		// Only `branch.<name>.rebase` or `pushRemote` is set; the branch doesn't track anything
+		if tracked.Remote == "" && tracked.Merge == "" {
+			delete(result, name)
+			continue
+		}
+		if config.Get("branch."+name+".pushRemote") != "" {
+			continue
+		}
+		if pushDefault != "" {
+			tracked.PushRemote = pushDefault
+		} else {
+			tracked.PushRemote = tracked.Remote
+		}
+	}
+	return nil
+}
+
+// ConfigBool returns true if 'value' is one of git's boolean true values
+func ConfigBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
+// configContext holds the repository state needed to evaluate `[includeIf]` conditions
+type configContext struct {
+	gitDir string
+	branch string
+}
+
+// maxIncludeDepth matches the include depth limit git enforces
+const maxIncludeDepth = 10
+
+// ReadConfig reads the system, global, local and worktree config files in the order git
+// reads them, so the last value of a key is the one git would use. 'gitDir' is the git
+// dir of the current worktree and 'commonDir' the git dir shared by all worktrees.
+func ReadConfig(result Config, gitDir, commonDir, branch string) error {
+	ctx := &configContext{gitDir: gitDir, branch: branch}
+
+	for _, path := range configFiles(gitDir, commonDir) {
+		if err := readConfigFile(result, path, ctx, 0); err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				continue
+			}
+			return err
+		}
+		// The worktree config is only consulted if the extension is enabled in the local config
+		if path == filepath.Join(commonDir, "config") && ConfigBool(result.Get("extensions.worktreeConfig")) {
+			worktree := filepath.Join(gitDir, "config.worktree")
+			if err := readConfigFile(result, worktree, ctx, 0); err != nil && !os.IsNotExist(errors.Cause(err)) {
+				return err
+			}
+		}
+	}
+	// Like git, `git -c` config in GIT_CONFIG_PARAMETERS is applied last so it wins over the environment
+	if err := readConfigEnv(result); err != nil {
+		return err
+	}
+	return readConfigParameters(result)
+}
+
+// configFiles returns the system, global and local config files that exist
+func configFiles(gitDir, commonDir string) []string {
+	var files []string
+
+	// System scope
+	if !ConfigBool(os.Getenv("GIT_CONFIG_NOSYSTEM")) {
+		if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+			files = append(files, path)
+		} else {
+			files = append(files, "/etc/gitconfig")
+		}
+	}
+
+	// Global scope
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		files = append(files, path)
+	} else {
+		home := os.Getenv("HOME")
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if xdg == "" && home != "" {
+			xdg = filepath.Join(home, ".config")
+		}
+		if xdg != "" {
+			files = append(files, filepath.Join(xdg, "git", "config"))
+		}
+		if home != "" {
+			files = append(files, filepath.Join(home, ".gitconfig"))
+		}
+	}
+
+	// Local scope
+	if commonDir != "" {
+		files = append(files, filepath.Join(commonDir, "config"))
+	}
+	return files
+}
+
+// readConfigEnv adds config passed via GIT_CONFIG_COUNT, GIT_CONFIG_KEY_<n> and GIT_CONFIG_VALUE_<n>
+func readConfigEnv(result Config) error {
+	count := os.Getenv("GIT_CONFIG_COUNT")
+	if count == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return errors.Errorf("bogus count in GIT_CONFIG_COUNT '%s'", count)
+	}
+	for i := 0; i < n; i++ {
+		key := os.Getenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", i))
+		if key == "" {
+			return errors.Errorf("missing config key GIT_CONFIG_KEY_%d", i)
+		}
+		result.Add(key, os.Getenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", i)))
+	}
+	return nil
+}
+
+// readConfigParameters adds config given with `git -c key=value`, which git passes to the
+// commands it runs in GIT_CONFIG_PARAMETERS as space separated shell quoted entries of
+// the form `'key'='value'`, or `'key=value'` in versions of git before 2.31
+func readConfigParameters(result Config) error {
+	params := strings.TrimLeft(os.Getenv("GIT_CONFIG_PARAMETERS"), " ")
+	for params != "" {
+		key, rest, err := sqDequote(params)
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasPrefix(rest, "="):
+			rest = rest[1:]
+			// `git -c key` without a value is passed as `'key'=` and is a boolean true
+			if rest == "" || strings.HasPrefix(rest, " ") {
+				result.Add(key, "true")
+				break
+			}
+			var value string
+			if value, rest, err = sqDequote(rest); err != nil {
+				return err
+			}
+			result.Add(key, value)
+		case strings.Contains(key, "="):
+			parts := strings.SplitN(key, "=", 2)
+			result.Add(parts[0], parts[1])
+		default:
+			// A key with no value is a boolean true
+			result.Add(key, "true")
+		}
+		if rest != "" && !strings.HasPrefix(rest, " ") {
+			return errors.New("bogus format in GIT_CONFIG_PARAMETERS")
+		}
+		params = strings.TrimLeft(rest, " ")
+	}
+	return nil
+}
+
+// sqDequote removes the shell quoting git adds to each word of GIT_CONFIG_PARAMETERS,
+// returning the unquoted word and the input following it
+func sqDequote(input string) (string, string, error) {
+	if !strings.HasPrefix(input, "'") {
+		return "", "", errors.New("bogus format in GIT_CONFIG_PARAMETERS")
+	}
+	var buf strings.Builder
+	for i := 1; i < len(input); i++ {
+		if input[i] != '\'' {
+			buf.WriteByte(input[i])
+			continue
+		}
+		// A quote or `!` in the word is quoted as `'\''` or `'\!'`
+		if strings.HasPrefix(input[i:], `'\`) && i+3 < len(input) && input[i+3] == '\'' {
+			buf.WriteByte(input[i+2])
+			i += 3
+			continue
+		}
+		return buf.String(), input[i+1:], nil
+	}
+	return "", "", errors.New("bogus format in GIT_CONFIG_PARAMETERS")
+}
+
+// ReadConfigFile parses the git config file at 'path' into 'result' following any includes.
+// `[includeIf]` conditions are evaluated against 'gitDir' and the current 'branch'.
+func ReadConfigFile(result Config, path, gitDir, branch string) error {
+	return readConfigFile(result, path, &configContext{gitDir: gitDir, branch: branch}, 0)
+}
+
+func readConfigFile(result Config, path string, ctx *configContext, depth int) error {
+	if depth > maxIncludeDepth {
+		return errors.Errorf("exceeded maximum include depth (%d) while including '%s'", maxIncludeDepth, path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "readConfigFile()")
+	}
+
+	return ParseConfig(string(content), func(key, value string) error {
+		result.Add(key, value)
+
+		section, subsection, name := splitConfigKey(key)
+		if name != "path" {
+			return nil
+		}
+		switch {
+		case section == "include" && subsection == "":
+		case section == "includeif" && subsection != "":
+			if !ctx.matches(subsection, path) {
+				return nil
+			}
+		default:
+			return nil
+		}
+		include := expandConfigPath(value, filepath.Dir(path))
+		if err := readConfigFile(result, include, ctx, depth+1); err != nil {
+			// Missing include files are silently ignored by git
+			if os.IsNotExist(errors.Cause(err)) {
+				return nil
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// matches returns true if the `[includeIf "<condition>"]` condition is satisfied
+func (ctx *configContext) matches(condition, path string) bool {
+	switch {
+	case strings.HasPrefix(condition, "gitdir:"):
+		return matchGitDir(strings.TrimPrefix(condition, "gitdir:"), ctx.gitDir, path, false)
+	case strings.HasPrefix(condition, "gitdir/i:"):
+		return matchGitDir(strings.TrimPrefix(condition, "gitdir/i:"), ctx.gitDir, path, true)
+	case strings.HasPrefix(condition, "onbranch:"):
+		if ctx.branch == "" {
+			return false
+		}
+		pattern := strings.TrimPrefix(condition, "onbranch:")
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		return wildMatch(pattern, ctx.branch, false)
+	}
+	// Unsupported conditions such as `hasconfig:` never match
+	return false
+}
+
+func matchGitDir(pattern, gitDir, path string, foldCase bool) bool {
+	if gitDir == "" {
+		return false
+	}
+	if strings.HasPrefix(pattern, "./") {
+		pattern = filepath.Join(filepath.Dir(path), pattern[2:])
+	} else {
+		pattern = expandConfigPath(pattern, "")
+	}
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	pattern = filepath.ToSlash(pattern)
+
+	if wildMatch(pattern, filepath.ToSlash(gitDir), foldCase) {
+		return true
+	}
+	// Git also matches against the real path of the git dir
+	if real, err := filepath.EvalSymlinks(gitDir); err == nil && real != gitDir {
+		return wildMatch(pattern, filepath.ToSlash(real), foldCase)
+	}
+	return false
+}
+
+// expandConfigPath expands a leading `~/` and makes 'path' relative to 'dir'
+func expandConfigPath(path, dir string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+	if !filepath.IsAbs(path) && dir != "" {
+		return filepath.Join(dir, path)
+	}
+	return path
+}
+
+// wildMatch matches 'name' against a glob 'pattern' where `*` does not match `/` and
+// `**` matches across directories. This is how git matches `[includeIf]` conditions, so
+// it deliberately differs from CompilePattern() where `*` also matches `/` so a protect
+// pattern such as `release/*` covers nested branch names.
+func wildMatch(pattern, name string, foldCase bool) bool {
+	var buf strings.Builder
+	if foldCase {
+		buf.WriteString("(?i)")
+	}
+	buf.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			buf.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			buf.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			buf.WriteString(".*")
+			i++
+		case c == '*':
+			buf.WriteString("[^/]*")
+		case c == '?':
+			buf.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end == -1 {
+				buf.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			buf.WriteString("[" + class + "]")
+			i += end
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	buf.WriteString("$")
+
+	regex, err := regexp.Compile(buf.String())
+	if err != nil {
+		return false
+	}
+	return regex.MatchString(name)
+}
+
+// ParseConfig parses the contents of a git config file calling 'fn' with the canonical key
+// and value of every variable in the order they appear.
+//
+//	[branch "Fix Me"]
+//		remote = origin
+//		merge = refs/heads/fix-me
+//
+// Calls fn("branch.Fix Me.remote", "origin") then fn("branch.Fix Me.merge", "refs/heads/fix-me")
+func ParseConfig(input string, fn func(key, value string) error) error {
+	p := &configParser{input: input, line: 1}
+	return p.parse(fn)
+}
+
+type configParser struct {
+	input   string
+	pos     int
+	line    int
+	section string
+}
+
+func (p *configParser) errorf(format string, args ...interface{}) error {
+	return errors.Errorf("bad config line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *configParser) peek() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *configParser) next() byte {
+	c := p.peek()
+	if c == '\n' {
+		p.line++
+	}
+	p.pos++
+	return c
+}
+
+func (p *configParser) eof() bool {
+	return p.pos >= len(p.input)
+}
+
+func (p *configParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\r') {
+		p.next()
+	}
+}
+
+func (p *configParser) skipLine() {
+	for !p.eof() && p.peek() != '\n' {
+		p.next()
+	}
+}
+
+func (p *configParser) parse(fn func(key, value string) error) error {
+	// Skip the UTF-8 byte order mark if present
+	if strings.HasPrefix(p.input, "\xef\xbb\xbf") {
+		p.pos = 3
+	}
+	for !p.eof() {
+		p.skipSpace()
+		c := p.peek()
+		switch {
+		case c == '\n':
+			p.next()
+		case c == '#' || c == ';':
+			p.skipLine()
+		case c == '[':
+			if err := p.parseSection(); err != nil {
+				return err
+			}
+		case isConfigAlpha(c):
+			if p.section == "" {
+				return p.errorf("variable outside of a section")
+			}
+			name := p.parseName()
+			value, err := p.parseValue()
+			if err != nil {
+				return err
+			}
+			if err := fn(p.section+"."+strings.ToLower(name), value); err != nil {
+				return err
+			}
+		case c == 0:
+			p.next()
+		default:
+			return p.errorf("unexpected character '%c'", c)
+		}
+	}
+	return nil
+}
+
+// parseSection parses `[section]`, `[section "subsection"]` or the deprecated `[section.subsection]`
+func (p *configParser) parseSection() error {
+	p.next() // '['
+	var name strings.Builder
+	for {
+		c := p.peek()
+		if isConfigAlpha(c) || (c >= '0' && c <= '9') || c == '-' || c == '.' {
+			name.WriteByte(p.next())
+			continue
+		}
+		break
+	}
+	section := strings.ToLower(name.String())
+	if section == "" {
+		return p.errorf("empty section name")
+	}
+
+	p.skipSpace()
+	switch p.peek() {
+	case ']':
+		p.next()
+		// Deprecated syntax `[section.subsection]` lower cases the subsection
+		p.section = section
+		return nil
+	case '"':
+		p.next()
+		var sub strings.Builder
+		for {
+			if p.eof() || p.peek() == '\n' {
+				return p.errorf("unterminated subsection")
+			}
+			c := p.next()
+			if c == '"' {
+				break
+			}
+			if c == '\\' {
+				if p.eof() || p.peek() == '\n' {
+					return p.errorf("unterminated subsection")
+				}
+				// Any escaped character is taken literally
+				c = p.next()
+			}
+			sub.WriteByte(c)
+		}
+		if p.next() != ']' {
+			return p.errorf("expected ']' after subsection")
+		}
+		p.section = section + "." + sub.String()
+		return nil
+	}
+	return p.errorf("invalid section header")
+}
+
+func (p *configParser) parseName() string {
+	var name strings.Builder
+	for {
+		c := p.peek()
+		if isConfigAlpha(c) || (c >= '0' && c <= '9') || c == '-' {
+			name.WriteByte(p.next())
+			continue
+		}
+		return name.String()
+	}
+}
+
+// parseValue parses everything after the variable name up to the end of the line
+func (p *configParser) parseValue() (string, error) {
+	p.skipSpace()
+	switch p.peek() {
+	case 0, '\n', '#', ';':
+		// A variable with no value is a boolean true
+		p.skipLine()
+		return "true", nil
+	case '=':
+		p.next()
+	default:
+		return "", p.errorf("expected '=' after variable name")
+	}
+
+	p.skipSpace()
+	var value strings.Builder
+	var quoted bool
+	// Length of the value excluding trailing unquoted whitespace
+	trimmed := 0
+	for {
+		if p.eof() {
+			break
+		}
+		c := p.peek()
+		if c == '\n' {
+			if quoted {
+				return "", p.errorf("unterminated quoted value")
+			}
+			break
+		}
+		p.next()
+		if !quoted && (c == '#' || c == ';') {
+			p.skipLine()
+			break
+		}
+		switch c {
+		case '"':
+			quoted = !quoted
+			continue
+		case '\\':
+			esc := p.next()
+			switch esc {
+			case '\n':
+				// Line continuation
+				continue
+			case '\r':
+				if p.peek() == '\n' {
+					p.next()
+					continue
+				}
+				return "", p.errorf("invalid escape sequence")
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'b':
+				value.WriteByte('\b')
+			case '\\', '"':
+				value.WriteByte(esc)
+			default:
+				return "", p.errorf("invalid escape sequence '\\%c'", esc)
+			}
+			trimmed = value.Len()
+			continue
+		case '\r':
+			if !quoted && p.peek() == '\n' {
+				continue
+			}
+		}
+		value.WriteByte(c)
+		if quoted || (c != ' ' && c != '\t') {
+			trimmed = value.Len()
+		}
+	}
+	if quoted {
+		return "", p.errorf("unterminated quoted value")
+	}
+	return value.String()[:trimmed], nil
+}
+
+func isConfigAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func (b *NativeBackend) ListConfig(result Config, pattern string) error {
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return errors.Wrapf(err, "invalid config pattern '%s'", pattern)
+	}
+
+	// The current branch is needed to evaluate `[includeIf "onbranch:..."]`
+	head, err := b.ReadSymbolicRef("HEAD")
+	if err != nil {
+		return err
+	}
+
+	config := Config{}
+	if err := ReadConfig(config, b.GitDir, b.CommonDir, strings.TrimPrefix(head, "refs/heads/")); err != nil {
+		return err
+	}
+	for key, values := range config {
+		if regex.MatchString(key) {
+			result[key] = append(result[key], values...)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package clip_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var gitConfigFile = `# A comment
+[core]
+	bare = false ; trailing comment
+	autocrlf
+[branch "Fix Me.v2"]
+	remote = origin
+	merge = refs/heads/fix-me
+	rebase = true
+[branch "master"] remote = origin
+	merge = refs/heads/master
+[remote "origin"]
+	url = git@github.com:thrawn01/clip.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+[Alias]
+	Quoted = "  keep  # this  "
+	escaped = "tab\there \"quote\" back\\slash"
+	continued = first \
+second
+	spaced = a  b   
+[Sub.Section]
+	name = value
+[weird "sub \"quote\" \\ slash"]
+	key = yes
+`
+
+var _ = Describe("Config", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-config")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	Describe("ParseConfigList()", func() {
+		It("Should parse null terminated config output", func() {
+			config := clip.Config{}
+			err := clip.ParseConfigList(config, "core.bare\nfalse\x00core.Foo\x00"+
+				"remote.origin.fetch\na\x00remote.origin.fetch\nb\x00")
+			Expect(err).To(BeNil())
+			Expect(config.Get("core.bare")).To(Equal("false"))
+			Expect(config.Get("core.foo")).To(Equal("true"))
+			Expect(config.GetAll("remote.origin.fetch")).To(Equal([]string{"a", "b"}))
+			Expect(config.Get("remote.origin.fetch")).To(Equal("b"))
+		})
+	})
+	Describe("CanonicalConfigKey()", func() {
+		It("Should lower case the section and name but not the subsection", func() {
+			Expect(clip.CanonicalConfigKey("Branch.My.Fix.Remote")).To(Equal("branch.My.Fix.remote"))
+			Expect(clip.CanonicalConfigKey("Core.Bare")).To(Equal("core.bare"))
+		})
+	})
+	Describe("ReadConfigFile()", func() {
+		It("Should parse quoted subsections, escapes and multi-valued keys", func() {
+			path := filepath.Join(root, "config")
+			writeFile(path, gitConfigFile)
+
+			config := clip.Config{}
+			Expect(clip.ReadConfigFile(config, path, "", "")).To(Succeed())
+			Expect(config.Get("core.bare")).To(Equal("false"))
+			Expect(config.Get("core.autocrlf")).To(Equal("true"))
+			Expect(config.Get("branch.Fix Me.v2.remote")).To(Equal("origin"))
+			Expect(config.Get("branch.master.remote")).To(Equal("origin"))
+			Expect(config.GetAll("remote.origin.fetch")).To(HaveLen(2))
+			Expect(config.Get("alias.quoted")).To(Equal("  keep  # this  "))
+			Expect(config.Get("alias.escaped")).To(Equal("tab\there \"quote\" back\\slash"))
+			Expect(config.Get("alias.continued")).To(Equal("first second"))
+			Expect(config.Get("alias.spaced")).To(Equal("a  b"))
+			Expect(config.Get("sub.section.name")).To(Equal("value"))
+			Expect(config.Get(`weird.sub "quote" \ slash.key`)).To(Equal("yes"))
+		})
+
+		It("Should match the output of `git config --list`", func() {
+			path := filepath.Join(root, "config")
+			writeFile(path, gitConfigFile)
+
+			config := clip.Config{}
+			Expect(clip.ReadConfigFile(config, path, "", "")).To(Succeed())
+
+			expected := clip.Config{}
+			output := git(root, "config", "--null", "--list", "--file", path)
+			Expect(clip.ParseConfigList(expected, output)).To(Succeed())
+			Expect(config).To(Equal(expected))
+		})
+
+		It("Should follow include and includeIf directives", func() {
+			gitDir := filepath.Join(root, "work", "project", ".git")
+			writeFile(filepath.Join(root, "config"), `[include]
+	path = included
+[includeIf "gitdir:work/"]
+	path = work
+[includeIf "gitdir:other/"]
+	path = other
+[includeIf "onbranch:feature/"]
+	path = feature
+[include]
+	path = missing
+`)
+			writeFile(filepath.Join(root, "included"), "[user]\n\temail = home@example.com\n")
+			writeFile(filepath.Join(root, "work"), "[user]\n\temail = work@example.com\n")
+			writeFile(filepath.Join(root, "other"), "[user]\n\temail = other@example.com\n")
+			writeFile(filepath.Join(root, "feature"), "[clip]\n\ttrunk = develop\n")
+
+			config := clip.Config{}
+			Expect(clip.ReadConfigFile(config, filepath.Join(root, "config"), gitDir, "feature/one")).To(Succeed())
+			Expect(config.GetAll("user.email")).To(Equal([]string{"home@example.com", "work@example.com"}))
+			Expect(config.Get("clip.trunk")).To(Equal("develop"))
+
+			config = clip.Config{}
+			Expect(clip.ReadConfigFile(config, filepath.Join(root, "config"), gitDir, "master")).To(Succeed())
+			Expect(config.Get("clip.trunk")).To(Equal(""))
+		})
+
+		It("Should report syntax errors with the line number", func() {
+			path := filepath.Join(root, "config")
+			writeFile(path, "[core]\n\tbare = \"unterminated\n")
+
+			err := clip.ReadConfigFile(clip.Config{}, path, "", "")
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("line 2"))
+		})
+	})
+	Describe("ReadConfig()", func() {
+		It("Should read global, local and worktree scopes in order", func() {
+			os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+			os.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(root, "global"))
+			defer os.Unsetenv("GIT_CONFIG_NOSYSTEM")
+			defer os.Unsetenv("GIT_CONFIG_GLOBAL")
+
+			commonDir := filepath.Join(root, ".git")
+			gitDir := filepath.Join(commonDir, "worktrees", "wt")
+			writeFile(filepath.Join(root, "global"), "[clip]\n\ttrunk = global\n\tbase = one\n")
+			writeFile(filepath.Join(commonDir, "config"), "[extensions]\n\tworktreeConfig = true\n"+
+				"[clip]\n\ttrunk = local\n\tbase = two\n")
+			writeFile(filepath.Join(gitDir, "config.worktree"), "[clip]\n\ttrunk = worktree\n")
+
+			config := clip.Config{}
+			Expect(clip.ReadConfig(config, gitDir, commonDir, "")).To(Succeed())
+			Expect(config.Get("clip.trunk")).To(Equal("worktree"))
+			Expect(config.GetAll("clip.base")).To(Equal([]string{"one", "two"}))
+		})
+		It("Should apply `git -c` config after GIT_CONFIG_COUNT", func() {
+			os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+			os.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(root, "global"))
+			os.Setenv("GIT_CONFIG_COUNT", "1")
+			os.Setenv("GIT_CONFIG_KEY_0", "clip.trunk")
+			os.Setenv("GIT_CONFIG_VALUE_0", "env")
+			os.Setenv("GIT_CONFIG_PARAMETERS", `'clip.trunk'='it'\''s'\!'' 'Clip.Base=old' 'clip.bare'= 'clip.empty'=''`)
+			defer os.Unsetenv("GIT_CONFIG_NOSYSTEM")
+			defer os.Unsetenv("GIT_CONFIG_GLOBAL")
+			defer os.Unsetenv("GIT_CONFIG_COUNT")
+			defer os.Unsetenv("GIT_CONFIG_KEY_0")
+			defer os.Unsetenv("GIT_CONFIG_VALUE_0")
+			defer os.Unsetenv("GIT_CONFIG_PARAMETERS")
+
+			config := clip.Config{}
+			Expect(clip.ReadConfig(config, "", "", "")).To(Succeed())
+			Expect(config.Get("clip.trunk")).To(Equal("it's!"))
+			Expect(config.Get("clip.base")).To(Equal("old"))
+			Expect(config.Get("clip.bare")).To(Equal("true"))
+			Expect(config.GetAll("clip.empty")).To(Equal([]string{""}))
+		})
+	})
+	Describe("ParseTrackedBranches()", func() {
+		It("Should name branches whose merge line comes before the remote line", func() {
+			tracked := clip.TrackedBranchMap{}
+			err := clip.ParseTrackedBranches(tracked, "branch.fix.v1.merge refs/heads/fix\n"+
+				"branch.fix.v1.remote upstream\n")
+			Expect(err).To(BeNil())
+			Expect(tracked["fix.v1"].Name).To(Equal("fix.v1"))
+			Expect(tracked["fix.v1"].Remote).To(Equal("upstream"))
+			Expect(tracked["fix.v1"].Merge).To(Equal("refs/heads/fix"))
+		})
+	})
+	Describe("ParseTrackedConfig()", func() {
+		It("Should resolve the push remote and rebase settings", func() {
+			config := clip.Config{}
+			config.Add("remote.pushDefault", "fork")
+			config.Add("branch.master.remote", "origin")
+			config.Add("branch.master.merge", "refs/heads/master")
+			config.Add("branch.master.pushRemote", "origin")
+			config.Add("branch.fix.remote", "origin")
+			config.Add("branch.fix.merge", "refs/heads/fix")
+			config.Add("branch.fix.rebase", "interactive")
+			config.Add("branch.untracked.rebase", "true")
+
+			tracked := clip.TrackedBranchMap{}
+			Expect(clip.ParseTrackedConfig(tracked, config)).To(Succeed())
+			Expect(tracked).To(HaveLen(2))
+			Expect(tracked["master"].PushRemote).To(Equal("origin"))
+			Expect(tracked["fix"].PushRemote).To(Equal("fork"))
+			Expect(tracked["fix"].Rebase).To(Equal("interactive"))
+		})
+	})
+})
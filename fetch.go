@@ -0,0 +1,197 @@
+package clip
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FetchResult is the outcome of fetching a single remote
+type FetchResult struct {
+	Remote string
+	Err    error
+}
+
+// FetchRemotes fetches all 'remotes' at once with `git fetch --multiple` pruning branches
+// deleted on the remote. A remote failing to fetch does not stop the others, the results
+// are in the order of 'remotes'. If 'ctx' is cancelled the fetch is stopped and the context
+// error returned.
+func (r *Repository) FetchRemotes(ctx context.Context, remotes []string) ([]FetchResult, error) {
+	failed := map[string]error{}
+	err := r.Backend.Fetch(ctx, failed, remotes)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+
+	results := make([]FetchResult, len(remotes))
+	for idx, remote := range remotes {
+		results[idx] = FetchResult{Remote: remote, Err: failed[remote]}
+		if err != nil {
+			results[idx].Err = err
+		}
+	}
+	return results, ctx.Err()
+}
+
+// LastFetch returns when each of 'remotes' was last fetched. This is the time FETCH_HEAD
+// was written if it lists a ref from the remote, remotes it doesn't mention are left out.
+func (r *Repository) LastFetch(remotes []string) (map[string]time.Time, error) {
+	config := Config{}
+	if err := r.Backend.ListConfig(config, `^remote\..*\.url$`); err != nil {
+		return nil, err
+	}
+	path, err := r.Backend.FetchHeadPath()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]time.Time{}
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, errors.Wrap(err, "LastFetch()")
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "LastFetch()")
+	}
+
+	fetched := map[string]bool{}
+	for _, url := range ParseFetchHead(string(content)) {
+		fetched[url] = true
+	}
+	for _, remote := range remotes {
+		if fetched[trimFetchURL(config.Get("remote."+remote+".url"))] {
+			result[remote] = stat.ModTime()
+		}
+	}
+	return result, nil
+}
+
+// ParseFetchHead returns the urls of the remotes fetched into FETCH_HEAD in the order they
+// first appear. Each line looks like
+//
+//	<sha>\t[not-for-merge]\tbranch 'main' of <url>
+func ParseFetchHead(content string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		idx := strings.LastIndex(fields[2], " of ")
+		if idx == -1 {
+			continue
+		}
+		url := trimFetchURL(fields[2][idx+len(" of "):])
+		if !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// trimFetchURL removes the trailing slashes and `.git` git strips from urls it writes to
+// FETCH_HEAD
+func trimFetchURL(url string) string {
+	url = strings.TrimRight(url, "/")
+	return strings.TrimSuffix(url, ".git")
+}
+
+// SortedRemotes returns the names in 'remotes' as returned by ListRemotes() sorted
+func SortedRemotes(remotes map[string]bool) []string {
+	var names []string
+	for name := range remotes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b *ExecBackend) Fetch(ctx context.Context, failed map[string]error, remotes []string) error {
+	if len(remotes) == 0 {
+		return nil
+	}
+	// `git fetch --multiple` empties FETCH_HEAD before its fetches append to it
+	args := []string{"fetch", "--quiet", "--prune", "--multiple", "--jobs=" + strconv.Itoa(len(remotes))}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", append(args, remotes...)...)
+	cmd.Dir = b.Dir
+	cmd.Env = b.Env
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	// Only an error if git failed before it could fetch the remotes
+	before := len(failed)
+	ParseFetchErrors(failed, stderr.String())
+	if len(failed) == before || ctx.Err() != nil {
+		return errors.Wrapf(err, "error running 'git %s': %s", args,
+			strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// ParseFetchErrors adds the error of each remote `git fetch --multiple` could not fetch to
+// 'result' keyed by remote. Git prints the output of each fetch as a whole followed by
+// `could not fetch '<remote>' (exit code: <code>)`, or `error: could not fetch <remote>`
+// when fetching one remote at a time. The first error in the output of the fetch is used.
+func ParseFetchErrors(result map[string]error, stderr string) {
+	var reason string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		var remote string
+		switch {
+		case strings.HasPrefix(line, "could not fetch '"):
+			remote = strings.TrimPrefix(line, "could not fetch '")
+			if idx := strings.LastIndex(remote, "' (exit code"); idx != -1 {
+				remote = remote[:idx]
+			}
+		case strings.HasPrefix(line, "error: could not fetch "):
+			remote = strings.TrimPrefix(line, "error: could not fetch ")
+		default:
+			if reason == "" && (strings.HasPrefix(line, "fatal: ") || strings.HasPrefix(line, "error: ")) {
+				reason = line
+			}
+			continue
+		}
+		if reason == "" {
+			reason = line
+		}
+		result[remote] = errors.New(reason)
+		reason = ""
+	}
+}
+
+func (b *ExecBackend) FetchHeadPath() (string, error) {
+	var output string
+	if err := b.git(&output, "rev-parse", "--git-path", "FETCH_HEAD"); err != nil {
+		return "", errors.Wrap(err, "FetchHeadPath()")
+	}
+	path := strings.TrimSpace(output)
+	// Relative to the directory git was run from
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(b.Dir, path)
+	}
+	return filepath.Abs(path)
+}
+
+// FetchHeadPath returns FETCH_HEAD in the git directory of the worktree, it is not shared
+func (b *NativeBackend) FetchHeadPath() (string, error) {
+	return filepath.Join(b.GitDir, "FETCH_HEAD"), nil
+}
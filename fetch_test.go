@@ -0,0 +1,111 @@
+package clip_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var fetchHead = "f154be847aa0e0b1ac213df8ce07fdda8f15ac4e\t\tbranch 'main' of /tmp/remote\n" +
+	"79f5c3f5f3cae845a1fb3f0deca886f03ba7221a\tnot-for-merge\tbranch 'old' of /tmp/remote\n" +
+	"79f5c3f5f3cae845a1fb3f0deca886f03ba7221a\tnot-for-merge\tbranch 'main' of https://example.com/clip\n"
+
+var _ = Describe("ParseFetchHead()", func() {
+	It("Should list each fetched url once", func() {
+		Expect(clip.ParseFetchHead(fetchHead)).To(Equal([]string{"/tmp/remote", "https://example.com/clip"}))
+	})
+})
+
+var _ = Describe("ParseFetchErrors()", func() {
+	It("Should name the first error of each failed remote", func() {
+		failed := map[string]error{}
+		clip.ParseFetchErrors(failed, "fatal: 'a' does not appear to be a git repository\n"+
+			"fatal: Could not read from remote repository.\n\n"+
+			"could not fetch 'one' (exit code: 128)\n"+
+			"could not fetch 'two' (exit code: 1)\n"+
+			"error: could not fetch three\n")
+		Expect(failed).To(HaveLen(3))
+		Expect(failed["one"]).To(MatchError("fatal: 'a' does not appear to be a git repository"))
+		Expect(failed["two"]).To(MatchError("could not fetch 'two' (exit code: 1)"))
+		Expect(failed["three"]).To(MatchError("error: could not fetch three"))
+	})
+})
+
+var _ = Describe("FetchRemotes()", func() {
+	var root, work string
+	var repo *clip.Repository
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-fetch")
+		Expect(err).To(BeNil())
+
+		remote := filepath.Join(root, "remote.git")
+		work = filepath.Join(root, "work")
+		git(root, "init", "-q", "--bare", remote)
+		git(root, "init", "-q", "-b", "main", work)
+		git(work, "commit", "-q", "--allow-empty", "-m", "init")
+		git(work, "remote", "add", "origin", remote+"/")
+		git(work, "remote", "add", "broken", filepath.Join(root, "missing.git"))
+		git(work, "push", "-q", "origin", "main", "main:stale")
+		git(work, "fetch", "-q", "origin")
+		git(remote, "branch", "-D", "stale")
+		repo = clip.NewRepository(clip.NewExecBackend(work))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Should fetch every remote and prune deleted branches", func() {
+		results, err := repo.FetchRemotes(context.Background(), []string{"broken", "origin"})
+		Expect(err).To(BeNil())
+		Expect(len(results)).To(Equal(2))
+		Expect(results[0].Remote).To(Equal("broken"))
+		Expect(results[0].Err).To(MatchError(ContainSubstring("does not appear to be a git repository")))
+		Expect(results[1].Remote).To(Equal("origin"))
+		Expect(results[1].Err).To(BeNil())
+
+		refs := clip.BranchReferenceMap{}
+		Expect(repo.ListBranchRefs(refs)).To(Succeed())
+		Expect(refs["origin"]).To(HaveKey("main"))
+		Expect(refs["origin"]).NotTo(HaveKey("stale"))
+	})
+
+	It("Should stop fetching when cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		results, err := repo.FetchRemotes(ctx, []string{"origin"})
+		Expect(err).To(Equal(context.Canceled))
+		Expect(results[0].Err).NotTo(BeNil())
+
+		refs := clip.BranchReferenceMap{}
+		Expect(repo.ListBranchRefs(refs)).To(Succeed())
+		Expect(refs["origin"]).To(HaveKey("stale"))
+	})
+
+	It("Should fail if a remote does not exist", func() {
+		_, err := repo.FetchRemotes(context.Background(), []string{"origin", "nosuch"})
+		Expect(err).To(MatchError(ContainSubstring("no such remote")))
+	})
+
+	It("Should report when each remote was last fetched", func() {
+		fetched, err := repo.LastFetch([]string{"broken", "origin"})
+		Expect(err).To(BeNil())
+		Expect(fetched).To(HaveKey("origin"))
+		Expect(fetched).NotTo(HaveKey("broken"))
+
+		// Only the remotes in FETCH_HEAD are known
+		path, err := clip.NewExecBackend(work).FetchHeadPath()
+		Expect(err).To(BeNil())
+		Expect(os.Remove(path)).To(Succeed())
+		fetched, err = repo.LastFetch([]string{"broken", "origin"})
+		Expect(err).To(BeNil())
+		Expect(fetched).To(BeEmpty())
+	})
+})
@@ -13,4 +13,5 @@ require (
 	github.com/spf13/cast v1.3.0 // indirect
 	github.com/thrawn01/args v0.3.0
 	gopkg.in/ini.v1 v1.63.2 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
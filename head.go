@@ -0,0 +1,55 @@
+package clip
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Head is what HEAD of the current worktree points to
+type Head struct {
+	// Branch is the branch checked out or empty if HEAD is detached
+	Branch string
+	Sha    string
+	// Tags are the tags pointing at Sha, only listed if HEAD is detached
+	Tags []string
+}
+
+// Detached returns true if HEAD points at a commit instead of a branch
+func (h *Head) Detached() bool {
+	return h.Branch == ""
+}
+
+// ResolveHead returns what HEAD of the current worktree in 'worktrees' points to, in a
+// bare repository only the branch HEAD points to is known
+func (r *Repository) ResolveHead(worktrees []*Worktree) (*Head, error) {
+	current := CurrentWorktree(worktrees)
+	if current == nil {
+		branch, err := r.CurrentBranch()
+		if err != nil {
+			return nil, err
+		}
+		return &Head{Branch: branch}, nil
+	}
+
+	head := &Head{Branch: current.Branch, Sha: current.Head}
+	if head.Detached() {
+		if err := r.Backend.TagsAt(&head.Tags, head.Sha); err != nil {
+			return nil, err
+		}
+	}
+	return head, nil
+}
+
+func (b *ExecBackend) TagsAt(tags *[]string, sha string) error {
+	var output string
+	if err := b.git(&output, "tag", "--points-at", sha); err != nil {
+		return errors.Wrap(err, "TagsAt()")
+	}
+	for _, tag := range strings.Split(strings.TrimSpace(output), "\n") {
+		if tag != "" {
+			*tags = append(*tags, tag)
+		}
+	}
+	return nil
+}
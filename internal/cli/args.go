@@ -0,0 +1,21 @@
+package cli
+
+import "strings"
+
+// SplitArgs splits `--name=value` into `--name value` as the argument parser only accepts
+// the latter. Arguments following `--` are left alone.
+func SplitArgs(args []string) []string {
+	var result []string
+	for idx, arg := range args {
+		if arg == "--" {
+			return append(result, args[idx:]...)
+		}
+		if strings.HasPrefix(arg, "--") && strings.Contains(arg, "=") {
+			parts := strings.SplitN(arg, "=", 2)
+			result = append(result, parts[0], parts[1])
+			continue
+		}
+		result = append(result, arg)
+	}
+	return result
+}
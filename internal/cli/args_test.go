@@ -0,0 +1,21 @@
+package cli_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip/internal/cli"
+)
+
+func TestCli(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Command Line")
+}
+
+var _ = Describe("SplitArgs()", func() {
+	It("Should split long options with values", func() {
+		Expect(cli.SplitArgs([]string{"--format=json", "-w", "2", "--base=a=b", "--", "--x=y"})).
+			To(Equal([]string{"--format", "json", "-w", "2", "--base", "a=b", "--", "--x=y"}))
+	})
+})
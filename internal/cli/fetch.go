@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thrawn01/clip"
+)
+
+// FetchRemotes fetches 'remotes' reporting the progress on stderr, remotes that fail to
+// fetch are reported but don't stop the others. An error is only returned if the fetch
+// failed for another reason or 'ctx' was cancelled.
+func FetchRemotes(ctx context.Context, repo *clip.Repository, remotes []string) error {
+	if len(remotes) == 0 {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Fetching %s..\n", strings.Join(remotes, ", "))
+	start := time.Now()
+	results, err := repo.FetchRemotes(ctx, remotes)
+	if err != nil {
+		return err
+	}
+	var fetched []string
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to fetch %s: %s\n", result.Remote, result.Err)
+			continue
+		}
+		fetched = append(fetched, result.Remote)
+	}
+	if len(fetched) != 0 {
+		fmt.Fprintf(os.Stderr, "Fetched %s in %s\n", strings.Join(fetched, ", "),
+			time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// CancelOnInterrupt returns a copy of 'ctx' which is cancelled on the first Ctrl-C. A second
+// Ctrl-C kills the process even if a git command hangs.
+func CancelOnInterrupt(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go func() {
+		<-signals
+		cancel()
+		signal.Stop(signals)
+	}()
+	return ctx
+}
@@ -0,0 +1,206 @@
+package clip
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Journal actions
+const (
+	JournalDelete  = "delete"
+	JournalRestore = "restore"
+)
+
+// JournalEntry records a remote branch deleted or restored by clip
+type JournalEntry struct {
+	ID     int       `json:"id"`
+	Action string    `json:"action"`
+	Time   time.Time `json:"time"`
+	Remote string    `json:"remote"`
+	Branch string    `json:"branch"`
+	Sha    string    `json:"sha"`
+	// Restores is the ID of the delete entry a restore undid
+	Restores int `json:"restores,omitempty"`
+}
+
+// JournalAnchor returns the local ref which keeps the sha of the delete entry 'id' from
+// being garbage collected until the deletion is restored
+func JournalAnchor(id int) string {
+	return "refs/clip/journal/" + strconv.Itoa(id)
+}
+
+// Journal is an append only log of remote branch deletions stored as one JSON entry per line
+type Journal struct {
+	Path string
+}
+
+// OpenJournal returns the journal kept in the git directory 'gitDir'
+func OpenJournal(gitDir string) *Journal {
+	return &Journal{Path: filepath.Join(gitDir, "clip", "journal")}
+}
+
+// Entries returns every entry in the journal oldest first
+func (j *Journal) Entries() ([]JournalEntry, error) {
+	file, err := os.Open(j.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "Entries()")
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, errors.Wrapf(err, "while reading journal '%s'", j.Path)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.Wrap(scanner.Err(), "Entries()")
+}
+
+// Record appends 'entry' to the journal assigning it the next ID and the current time. The
+// journal is locked while the ID is assigned so concurrent clips don't assign the same ID.
+func (j *Journal) Record(entry JournalEntry) (JournalEntry, error) {
+	if err := os.MkdirAll(filepath.Dir(j.Path), 0755); err != nil {
+		return entry, errors.Wrap(err, "Record()")
+	}
+	unlock, err := j.lock()
+	if err != nil {
+		return entry, err
+	}
+	defer unlock()
+
+	entries, err := j.Entries()
+	if err != nil {
+		return entry, err
+	}
+	entry.ID = 1
+	if len(entries) != 0 {
+		entry.ID = entries[len(entries)-1].ID + 1
+	}
+	entry.Time = time.Now().UTC()
+
+	file, err := os.OpenFile(j.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return entry, errors.Wrap(err, "Record()")
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return entry, errors.Wrap(err, "Record()")
+	}
+	_, err = file.Write(append(line, '\n'))
+	return entry, errors.Wrap(err, "Record()")
+}
+
+// journalLockTimeout is how long Record() waits for another clip to release the journal
+const journalLockTimeout = 5 * time.Second
+
+// lock creates the lock file of the journal, the way git locks a file it updates, and
+// returns a func which removes it
+func (j *Journal) lock() (func(), error) {
+	path := j.Path + ".lock"
+	deadline := time.Now().Add(journalLockTimeout)
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) || time.Now().After(deadline) {
+			return nil, errors.Wrapf(err, "while locking journal '%s'", j.Path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// FindDeletion returns the delete entry with the ID 'id', or if 'id' is "last" the most
+// recent deletion which has not been restored
+func (j *Journal) FindDeletion(id string) (*JournalEntry, error) {
+	entries, err := j.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	restored := map[int]bool{}
+	for _, entry := range entries {
+		if entry.Action == JournalRestore {
+			restored[entry.Restores] = true
+		}
+	}
+
+	if id == "last" {
+		for idx := len(entries) - 1; idx >= 0; idx-- {
+			if entries[idx].Action == JournalDelete && !restored[entries[idx].ID] {
+				return &entries[idx], nil
+			}
+		}
+		return nil, errors.New("no deletions to undo in the journal")
+	}
+
+	num, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, errors.Errorf("invalid journal id '%s'", id)
+	}
+	for idx := range entries {
+		if entries[idx].ID == num && entries[idx].Action == JournalDelete {
+			if restored[num] {
+				return nil, errors.Errorf("journal entry %d was already restored", num)
+			}
+			return &entries[idx], nil
+		}
+	}
+	return nil, errors.Errorf("no deletion with id %d in the journal", num)
+}
+
+// Journal returns the deletion journal of the repository
+func (r *Repository) Journal() (*Journal, error) {
+	gitDir, err := r.Backend.GitCommonDir()
+	if err != nil {
+		return nil, err
+	}
+	return OpenJournal(gitDir), nil
+}
+
+// RestoreRemoteBranch recreates the remote branch deleted by the journal entry 'id' by
+// pushing the sha it pointed to, 'id' may be "last" for the most recent deletion
+func (r *Repository) RestoreRemoteBranch(id string) (JournalEntry, error) {
+	journal, err := r.Journal()
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	deleted, err := journal.FindDeletion(id)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	if err := r.Backend.PushRef(deleted.Remote, deleted.Sha, "refs/heads/"+deleted.Branch); err != nil {
+		return JournalEntry{}, err
+	}
+	entry, err := journal.Record(JournalEntry{
+		Action:   JournalRestore,
+		Remote:   deleted.Remote,
+		Branch:   deleted.Branch,
+		Sha:      deleted.Sha,
+		Restores: deleted.ID,
+	})
+	if err != nil {
+		return entry, err
+	}
+	// The remote has the commits again
+	return entry, r.Backend.DeleteRef(JournalAnchor(deleted.ID))
+}
@@ -0,0 +1,153 @@
+package clip_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/thrawn01/clip"
+)
+
+var _ = Describe("Journal", func() {
+	var backend *fakeBackend
+	var repo *clip.Repository
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-journal")
+		Expect(err).To(BeNil())
+		backend = &fakeBackend{config: gitConfigNull, refs: gitShowRef, gitDir: root}
+		repo = clip.NewRepository(backend)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Should record deletions in the git dir", func() {
+		results, err := repo.ClipRemoteBranches([]clip.Deletion{
+			{Remote: "origin", Branch: "fix-version", Sha: shaFix},
+		}, clip.ClipOpts{})
+		Expect(err).To(BeNil())
+		Expect(results[0].Err).To(BeNil())
+		Expect(results[0].Entry.ID).To(Equal(1))
+		Expect(backend.deleted).To(Equal([]string{"origin/fix-version"}))
+
+		entries, err := clip.OpenJournal(root).Entries()
+		Expect(err).To(BeNil())
+		Expect(len(entries)).To(Equal(1))
+		Expect(entries[0].Action).To(Equal(clip.JournalDelete))
+		Expect(entries[0].Sha).To(Equal(shaFix))
+		Expect(entries[0].Time.IsZero()).To(Equal(false))
+		Expect(filepath.Join(root, "clip", "journal")).To(BeAnExistingFile())
+		Expect(backend.anchors).To(Equal(map[string]string{"refs/clip/journal/1": shaFix}))
+	})
+
+	It("Should report a deletion whose sha could not be anchored as deleted", func() {
+		backend.anchorErr = errors.New("bad object " + shaFix)
+		results, err := repo.ClipRemoteBranches([]clip.Deletion{
+			{Remote: "origin", Branch: "fix-version", Sha: shaFix},
+		}, clip.ClipOpts{})
+		Expect(err).To(BeNil())
+		Expect(results[0].Err).To(BeNil())
+		Expect(results[0].Entry.ID).To(Equal(1))
+		Expect(results[0].AnchorErr).To(MatchError("while anchoring journal entry 1: bad object " + shaFix))
+	})
+
+	It("Should wait for another clip to release the journal lock", func() {
+		journal := clip.OpenJournal(root)
+		writeFile(journal.Path+".lock", "")
+
+		recorded := make(chan error)
+		go func() {
+			_, err := journal.Record(clip.JournalEntry{Action: clip.JournalDelete})
+			recorded <- err
+		}()
+		Consistently(recorded, "100ms").ShouldNot(Receive())
+		Expect(os.Remove(journal.Path + ".lock")).To(Succeed())
+		Eventually(recorded).Should(Receive(BeNil()))
+
+		entries, err := journal.Entries()
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(1))
+		Expect(journal.Path + ".lock").NotTo(BeAnExistingFile())
+	})
+
+	It("Should restore the last deletion and then earlier ones", func() {
+		_, err := repo.ClipRemoteBranches([]clip.Deletion{
+			{Remote: "origin", Branch: "one", Sha: shaFix},
+			{Remote: "upstream", Branch: "two", Sha: shaMaster},
+		}, clip.ClipOpts{})
+		Expect(err).To(BeNil())
+
+		entry, err := repo.RestoreRemoteBranch("last")
+		Expect(err).To(BeNil())
+		Expect(entry.ID).To(Equal(3))
+		Expect(entry.Restores).To(Equal(2))
+
+		Expect(backend.anchors).To(Equal(map[string]string{"refs/clip/journal/1": shaFix}))
+
+		_, err = repo.RestoreRemoteBranch("last")
+		Expect(err).To(BeNil())
+		Expect(backend.anchors).To(BeEmpty())
+		Expect(backend.pushed).To(Equal([]string{
+			"upstream " + shaMaster + ":refs/heads/two",
+			"origin " + shaFix + ":refs/heads/one",
+		}))
+
+		_, err = repo.RestoreRemoteBranch("last")
+		Expect(err).To(MatchError("no deletions to undo in the journal"))
+	})
+
+	It("Should restore by id only once", func() {
+		_, err := repo.ClipRemoteBranches([]clip.Deletion{
+			{Remote: "origin", Branch: "one", Sha: shaFix},
+		}, clip.ClipOpts{})
+		Expect(err).To(BeNil())
+		_, err = repo.RestoreRemoteBranch("1")
+		Expect(err).To(BeNil())
+		_, err = repo.RestoreRemoteBranch("1")
+		Expect(err).To(MatchError("journal entry 1 was already restored"))
+		_, err = repo.RestoreRemoteBranch("5")
+		Expect(err).To(MatchError("no deletion with id 5 in the journal"))
+	})
+
+	It("Should keep deleted commits until they are restored", func() {
+		remote := filepath.Join(root, "remote.git")
+		work := filepath.Join(root, "work")
+		Expect(os.MkdirAll(work, 0755)).To(Succeed())
+		git(root, "init", "-q", "--bare", remote)
+		git(work, "init", "-q", "-b", "main")
+		git(work, "commit", "-q", "--allow-empty", "-m", "init")
+		git(work, "remote", "add", "origin", remote)
+		git(work, "checkout", "-q", "-b", "stale")
+		git(work, "commit", "-q", "--allow-empty", "-m", "stale")
+		sha := strings.TrimSpace(git(work, "rev-parse", "stale"))
+		git(work, "push", "-q", "origin", "main", "stale")
+		git(work, "checkout", "-q", "main")
+		git(work, "branch", "-q", "-D", "stale")
+
+		backend, err := clip.NewNativeBackend(work)
+		Expect(err).To(BeNil())
+		repo := clip.NewRepository(backend)
+		results, err := repo.ClipRemoteBranches([]clip.Deletion{
+			{Remote: "origin", Branch: "stale", Sha: sha},
+		}, clip.ClipOpts{})
+		Expect(err).To(BeNil())
+		Expect(results[0].Err).To(BeNil())
+		Expect(results[0].Entry.Sha).To(Equal(sha))
+		// Nothing but the anchor refers to the commit now
+		Expect(git(work, "for-each-ref", "--format=%(refname) %(objectname)", "--contains", sha)).
+			To(Equal("refs/clip/journal/1 " + sha + "\n"))
+
+		_, err = repo.RestoreRemoteBranch("last")
+		Expect(err).To(BeNil())
+		Expect(git(remote, "rev-parse", "stale")).To(Equal(sha + "\n"))
+		Expect(git(work, "for-each-ref", "refs/clip")).To(Equal(""))
+	})
+})
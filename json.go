@@ -0,0 +1,186 @@
+package clip
+
+// JSONVersion is the version of the JSON schema. It only changes when fields are removed or
+// their meaning changes, new fields may be added without changing the version.
+const JSONVersion = 1
+
+// JSONReport is the JSON representation of a Report
+type JSONReport struct {
+	Version     int          `json:"version"`
+	Trunk       string       `json:"trunk"`
+	TrunkSource string       `json:"trunk_source"`
+	Bases       []string     `json:"bases"`
+	Branches    []JSONBranch `json:"branches"`
+	Head        *JSONHead    `json:"head"`
+	// Stashes are made with HEAD detached or on branches that no longer exist
+	Stashes []JSONStash `json:"stashes"`
+}
+
+// JSONHead is the JSON representation of a Head
+type JSONHead struct {
+	Branch   string   `json:"branch"`
+	Sha      string   `json:"sha"`
+	Detached bool     `json:"detached"`
+	Tags     []string `json:"tags"`
+}
+
+// JSONStash is the JSON representation of a Stash
+type JSONStash struct {
+	Ref     string `json:"ref"`
+	Sha     string `json:"sha"`
+	Branch  string `json:"branch"`
+	Message string `json:"message"`
+}
+
+// JSONBranch is the JSON representation of a BranchDetail. When streamed as NDJSON each
+// branch is a line of its own carrying the schema version, NDJSON has no lines for the
+// Head and Stashes of the report.
+type JSONBranch struct {
+	Version int    `json:"version,omitempty"`
+	Name    string `json:"name"`
+	Sha     string `json:"sha"`
+	// IsTrunk is true for the trunk branch which has no trunk counts
+	IsTrunk bool `json:"is_trunk"`
+	// Current is true for the branch checked out in the current worktree
+	Current bool         `json:"current"`
+	Tracked *JSONTracked `json:"tracked"`
+	// Upstream is the state of the tracked branch, empty if the branch doesn't track one
+	Upstream string `json:"upstream"`
+	// Ahead and Behind are relative to the trunk
+	Ahead   int          `json:"ahead"`
+	Behind  int          `json:"behind"`
+	Merged  string       `json:"merged"`
+	Bases   []JSONCount  `json:"bases"`
+	Remotes []JSONRemote `json:"remotes"`
+	// Worktree is the worktree the branch is checked out in or null
+	Worktree *JSONWorktree `json:"worktree"`
+	Stashes  []JSONStash   `json:"stashes"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// JSONWorktree is the JSON representation of the Worktree a branch is checked out in
+type JSONWorktree struct {
+	Path      string `json:"path"`
+	Dirty     bool   `json:"dirty"`
+	Current   bool   `json:"current"`
+	Staged    int    `json:"staged"`
+	Unstaged  int    `json:"unstaged"`
+	Untracked int    `json:"untracked"`
+	// StatusError is set if the changes in the worktree could not be counted
+	StatusError string `json:"status_error,omitempty"`
+}
+
+// JSONTracked is the JSON representation of the TrackedBranch of a branch
+type JSONTracked struct {
+	Remote string `json:"remote"`
+	Merge  string `json:"merge"`
+}
+
+// JSONCount is the number of commits a branch is ahead and behind a base
+type JSONCount struct {
+	Name   string `json:"name"`
+	Ahead  int    `json:"ahead"`
+	Behind int    `json:"behind"`
+}
+
+// JSONRemote is a remote branch matching a branch and the commits the branch is ahead and
+// behind it
+type JSONRemote struct {
+	Ref    string `json:"ref"`
+	Sha    string `json:"sha"`
+	Ahead  int    `json:"ahead"`
+	Behind int    `json:"behind"`
+}
+
+// NewJSONReport converts 'report' into its JSON representation
+func NewJSONReport(report *Report) *JSONReport {
+	result := &JSONReport{
+		Version:     JSONVersion,
+		Trunk:       report.Trunk.Name,
+		TrunkSource: report.TrunkSource,
+		Bases:       []string{},
+		Branches:    []JSONBranch{},
+		Stashes:     newJSONStashes(report.Stashes),
+	}
+	if head := report.Head; head != nil {
+		result.Head = &JSONHead{Branch: head.Branch, Sha: head.Sha, Detached: head.Detached(),
+			Tags: append([]string{}, head.Tags...)}
+	}
+	for _, base := range report.Bases {
+		result.Bases = append(result.Bases, base.Name)
+	}
+	for _, branch := range report.Branches {
+		result.Branches = append(result.Branches, NewJSONBranch(branch, report.Trunk))
+	}
+	return result
+}
+
+// NewJSONBranch converts 'branch' into its JSON representation, 'trunk' is the trunk of
+// the report the branch is from
+func NewJSONBranch(branch, trunk *BranchDetail) JSONBranch {
+	result := JSONBranch{
+		Name:     branch.Name,
+		Sha:      branch.Sha,
+		IsTrunk:  branch == trunk,
+		Ahead:    branch.Trunk.Ahead,
+		Behind:   branch.Trunk.Behind,
+		Merged:   branch.Merged,
+		Upstream: branch.Upstream,
+		Bases:    []JSONCount{},
+		Remotes:  []JSONRemote{},
+		Stashes:  newJSONStashes(branch.Stashes),
+	}
+	if branch.Tracked != nil {
+		result.Tracked = &JSONTracked{Remote: branch.Tracked.Remote, Merge: branch.Tracked.Merge}
+	}
+	for _, base := range branch.Bases {
+		result.Bases = append(result.Bases, JSONCount{
+			Name:   base.Base,
+			Ahead:  base.Ahead,
+			Behind: base.Behind,
+		})
+	}
+	for _, remote := range branch.Remotes {
+		if remote == nil {
+			continue
+		}
+		count := branch.RemoteCounts[remote.Ref]
+		result.Remotes = append(result.Remotes, JSONRemote{
+			Ref:    remote.Ref,
+			Sha:    remote.Sha,
+			Ahead:  count.Ahead,
+			Behind: count.Behind,
+		})
+	}
+	if worktree := branch.Worktree; worktree != nil {
+		result.Current = worktree.Current
+		result.Worktree = &JSONWorktree{
+			Path:      worktree.Path,
+			Dirty:     worktree.Dirty,
+			Current:   worktree.Current,
+			Staged:    worktree.Status.Staged,
+			Unstaged:  worktree.Status.Unstaged,
+			Untracked: worktree.Status.Untracked,
+		}
+		if worktree.StatusErr != nil {
+			result.Worktree.StatusError = worktree.StatusErr.Error()
+		}
+	}
+	if branch.Err != nil {
+		result.Error = branch.Err.Error()
+	}
+	return result
+}
+
+func newJSONStashes(stashes []Stash) []JSONStash {
+	result := []JSONStash{}
+	for _, stash := range stashes {
+		result = append(result, JSONStash{
+			Ref:     stash.Ref,
+			Sha:     stash.Sha,
+			Branch:  stash.Branch,
+			Message: stash.Message,
+		})
+	}
+	return result
+}
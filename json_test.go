@@ -0,0 +1,70 @@
+package clip_test
+
+import (
+	"encoding/json"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var _ = Describe("NewJSONReport()", func() {
+	It("Should match the documented schema", func() {
+		trunk := &clip.BranchDetail{Name: "master", Sha: shaMaster}
+		worktree := &clip.Worktree{Path: "/src/fix", Branch: "fix-me-local", Dirty: true, Current: true,
+			Status: clip.StatusCounts{Staged: 1, Untracked: 2}}
+		fix := &clip.BranchDetail{
+			Name:     "fix-me-local",
+			Sha:      shaFix,
+			Tracked:  &clip.TrackedBranch{Remote: "upstream", Merge: "refs/heads/fix-version"},
+			Upstream: clip.UpstreamOK,
+			Worktree: worktree,
+			Stashes:  []clip.Stash{{Ref: "stash@{0}", Sha: shaTag, Branch: "fix-me-local", Message: "wip"}},
+			Remotes:  []*clip.Branch{{Name: "fix-version", Ref: "remotes/upstream/fix-version", Sha: shaLoose}},
+			Trunk:    clip.AheadBehind{Ahead: 2, Behind: 1},
+			Merged:   clip.MergedSquash,
+			Bases:    []clip.BaseCount{{Base: "origin/master", AheadBehind: clip.AheadBehind{Ahead: 2}}},
+			RemoteCounts: map[string]clip.AheadBehind{
+				"remotes/upstream/fix-version": {Behind: 3},
+			},
+		}
+		broken := &clip.BranchDetail{Name: "broken", Sha: shaTag, Err: errors.New("bad object")}
+		report := &clip.Report{
+			Trunk:       trunk,
+			TrunkSource: clip.TrunkFromConfig,
+			Bases:       []*clip.Branch{{Name: "origin/master"}},
+			Branches:    []*clip.BranchDetail{trunk, fix, broken},
+			Head:        &clip.Head{Branch: "fix-me-local", Sha: shaFix},
+		}
+
+		output, err := json.Marshal(clip.NewJSONReport(report))
+		Expect(err).To(BeNil())
+		Expect(output).To(MatchJSON(`{
+			"version": 1,
+			"trunk": "master",
+			"trunk_source": "clip.trunk",
+			"bases": ["origin/master"],
+			"branches": [
+				{"name": "master", "sha": "` + shaMaster + `", "is_trunk": true, "current": false, "tracked": null,
+				 "upstream": "", "ahead": 0, "behind": 0, "merged": "", "bases": [], "remotes": [],
+				 "worktree": null, "stashes": []},
+				{"name": "fix-me-local", "sha": "` + shaFix + `", "is_trunk": false, "current": true,
+				 "tracked": {"remote": "upstream", "merge": "refs/heads/fix-version"},
+				 "upstream": "ok", "ahead": 2, "behind": 1, "merged": "squash",
+				 "bases": [{"name": "origin/master", "ahead": 2, "behind": 0}],
+				 "remotes": [{"ref": "remotes/upstream/fix-version", "sha": "` + shaLoose + `",
+				              "ahead": 0, "behind": 3}],
+				 "worktree": {"path": "/src/fix", "dirty": true, "current": true,
+				              "staged": 1, "unstaged": 0, "untracked": 2},
+				 "stashes": [{"ref": "stash@{0}", "sha": "` + shaTag + `", "branch": "fix-me-local",
+				              "message": "wip"}]},
+				{"name": "broken", "sha": "` + shaTag + `", "is_trunk": false, "current": false, "tracked": null,
+				 "upstream": "", "ahead": 0, "behind": 0, "merged": "", "bases": [], "remotes": [],
+				 "worktree": null, "stashes": [], "error": "bad object"}
+			],
+			"head": {"branch": "fix-me-local", "sha": "` + shaFix + `", "detached": false, "tags": []},
+			"stashes": []
+		}`))
+	})
+})
@@ -0,0 +1,190 @@
+package clip
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// How a branch was found to be merged into the trunk
+const (
+	// Every commit on the branch is reachable from the trunk
+	MergedAncestor = "ancestor"
+	// Every commit on the branch has an equivalent patch on the trunk, as left by a rebase
+	// merge or cherry picking
+	MergedPatchID = "patch-id"
+	// The combined change of the branch has an equivalent patch on the trunk, as left by a
+	// squash merge
+	MergedSquash = "squash"
+)
+
+func (b *ExecBackend) MergeBase(shas ...string) (string, error) {
+	args := []string{"merge-base"}
+	if len(shas) > 2 {
+		args = append(args, "--octopus")
+	}
+	var output string
+	if err := b.git(&output, append(args, shas...)...); err != nil {
+		// `git merge-base` exits with 1 if there is no common ancestor
+		if isExitCode(err, 1) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "MergeBase()")
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (b *ExecBackend) CommitPatchIDs(result map[string]string, revs []string) error {
+	var log, output string
+	input := strings.Join(revs, "\n") + "\n"
+	if err := b.gitInput(&log, input, "log", "-p", "--binary", "--no-merges", "--format=commit %H", "--stdin"); err != nil {
+		return errors.Wrap(err, "CommitPatchIDs()")
+	}
+	if log == "" {
+		return nil
+	}
+	if err := b.gitInput(&output, log, "patch-id", "--stable"); err != nil {
+		return errors.Wrap(err, "CommitPatchIDs()")
+	}
+	ParsePatchIDs(result, output)
+	return nil
+}
+
+func (b *ExecBackend) DiffPatchIDs(result map[string]string, diffs []RevPair) error {
+	if len(diffs) == 0 {
+		return nil
+	}
+	// Given `<commit> <parent>` diff-tree diffs the commit against the parent it was given,
+	// which needn't be its real parent, under a header naming the commit
+	var input, diff, output string
+	for _, pair := range diffs {
+		input += pair.Branch + " " + pair.Base + "\n"
+	}
+	if err := b.gitInput(&diff, input, "diff-tree", "-p", "--binary", "--stdin"); err != nil {
+		return errors.Wrap(err, "DiffPatchIDs()")
+	}
+	if diff == "" {
+		return nil
+	}
+	if err := b.gitInput(&output, diff, "patch-id", "--stable"); err != nil {
+		return errors.Wrap(err, "DiffPatchIDs()")
+	}
+	ParsePatchIDs(result, output)
+	return nil
+}
+
+// ParsePatchIDs adds the patch ids in the output of `git patch-id` to 'result' keyed by the
+// commit each was computed for
+func ParsePatchIDs(result map[string]string, output string) {
+	for _, line := range strings.Split(output, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			result[fields[1]] = fields[0]
+		}
+	}
+}
+
+// MergedInto reports how the 'branch' sha was merged into the 'trunk' sha returning one of
+// the Merged constants, or an empty string if the branch has changes the trunk does not.
+func (r *Repository) MergedInto(branch, trunk string) (string, error) {
+	result := map[string]string{}
+	if err := r.MergedIntoAll(result, []string{branch}, trunk); err != nil {
+		return "", err
+	}
+	return result[branch], nil
+}
+
+// MergedIntoAll adds how each of 'branches' was merged into 'trunk' to 'result' keyed by
+// branch sha, see MergedInto(). The patch ids of the trunk are read once for every branch,
+// from the common ancestor of the trunk and all the branches, so checking many branches
+// runs a few git commands plus a `git merge-base` for each branch that was not rebased.
+func (r *Repository) MergedIntoAll(result map[string]string, branches []string, trunk string) error {
+	commits := map[string][]string{}
+	var pending []string
+	for _, branch := range branches {
+		if _, ok := commits[branch]; ok {
+			continue
+		}
+		var unique []string
+		if err := r.Backend.CommitsBetween(&unique, trunk, branch); err != nil {
+			return err
+		}
+		commits[branch] = unique
+		if len(unique) == 0 {
+			result[branch] = MergedAncestor
+			continue
+		}
+		pending = append(pending, branch)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Trunk commits reachable from every branch can't hold a change made on one of them
+	floor, err := r.Backend.MergeBase(append([]string{trunk}, pending...)...)
+	if err != nil {
+		return err
+	}
+	revs := []string{trunk}
+	if floor != "" {
+		revs = append(revs, "^"+floor)
+	}
+	trunkIDs := map[string]string{}
+	if err := r.Backend.CommitPatchIDs(trunkIDs, revs); err != nil {
+		return err
+	}
+	onTrunk := map[string]bool{}
+	for _, id := range trunkIDs {
+		onTrunk[id] = true
+	}
+
+	// A rebase merge or cherry pick leaves a trunk commit with the patch id of each commit
+	// on the branch
+	branchIDs := map[string]string{}
+	if err := r.Backend.CommitPatchIDs(branchIDs, append(pending, "^"+trunk)); err != nil {
+		return err
+	}
+	var diffs []RevPair
+	for _, branch := range pending {
+		if allOnTrunk(commits[branch], branchIDs, onTrunk) {
+			result[branch] = MergedPatchID
+			continue
+		}
+		base, err := r.Backend.MergeBase(trunk, branch)
+		if err != nil {
+			return err
+		}
+		if base != "" {
+			diffs = append(diffs, RevPair{Branch: branch, Base: base})
+		}
+	}
+
+	// A squash merge leaves a single commit on the trunk with the combined change of the
+	// branch since it forked from the trunk
+	squashIDs := map[string]string{}
+	if err := r.Backend.DiffPatchIDs(squashIDs, diffs); err != nil {
+		return err
+	}
+	for branch, id := range squashIDs {
+		if onTrunk[id] {
+			result[branch] = MergedSquash
+		}
+	}
+	return nil
+}
+
+// allOnTrunk returns true if every commit in 'commits' with a patch id has an equivalent
+// commit on the trunk. Like `git cherry`, merge commits are ignored.
+func allOnTrunk(commits []string, ids map[string]string, onTrunk map[string]bool) bool {
+	var found bool
+	for _, commit := range commits {
+		id, ok := ids[commit]
+		if !ok {
+			continue
+		}
+		if !onTrunk[id] {
+			return false
+		}
+		found = true
+	}
+	return found
+}
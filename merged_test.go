@@ -0,0 +1,118 @@
+package clip_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+// newMergedRepo creates branches merged into main by squash, rebase and fast forward along
+// with a branch that is not merged
+func newMergedRepo(root string) {
+	git(root, "init", "-q", "-b", "main")
+	git(root, "commit", "-q", "--allow-empty", "-m", "init")
+	for _, name := range []string{"squashed", "rebased", "open"} {
+		git(root, "checkout", "-q", "-b", name, "main")
+		writeFile(filepath.Join(root, name+".txt"), name+"\n")
+		git(root, "add", ".")
+		git(root, "commit", "-q", "-m", name+" one")
+		writeFile(filepath.Join(root, name+"-two.txt"), name+"\n")
+		git(root, "add", ".")
+		git(root, "commit", "-q", "-m", name+" two")
+	}
+	git(root, "checkout", "-q", "main")
+	git(root, "merge", "-q", "--squash", "squashed")
+	git(root, "commit", "-q", "-m", "squashed")
+	git(root, "cherry-pick", "rebased~1", "rebased")
+	git(root, "branch", "old", "main~1")
+	writeFile(filepath.Join(root, "main.txt"), "main\n")
+	git(root, "add", ".")
+	git(root, "commit", "-q", "-m", "main")
+}
+
+var _ = Describe("MergedInto()", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-merged")
+		Expect(err).To(BeNil())
+		newMergedRepo(root)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Should detect how each branch was merged", func() {
+		repo := clip.NewRepository(nativeBackend(root))
+		report, err := repo.Analyze(context.Background(), clip.AnalyzeOpts{})
+		Expect(err).To(BeNil())
+
+		merged := map[string]string{}
+		for _, branch := range report.Branches {
+			Expect(branch.Err).To(BeNil())
+			merged[branch.Name] = branch.Merged
+		}
+		Expect(merged).To(Equal(map[string]string{
+			"main":     "",
+			"old":      clip.MergedAncestor,
+			"squashed": clip.MergedSquash,
+			"rebased":  clip.MergedPatchID,
+			"open":     "",
+		}))
+	})
+
+	It("Should not write to the repository", func() {
+		before := git(root, "show-ref") + git(root, "count-objects", "-v")
+		repo := clip.NewRepository(clip.NewExecBackend(root))
+		merged, err := repo.MergedInto(strings.TrimSpace(git(root, "rev-parse", "squashed")),
+			strings.TrimSpace(git(root, "rev-parse", "main")))
+		Expect(err).To(BeNil())
+		Expect(merged).To(Equal(clip.MergedSquash))
+		Expect(git(root, "show-ref") + git(root, "count-objects", "-v")).To(Equal(before))
+	})
+
+	It("Should plan only merged or unmerged remote branches", func() {
+		for _, name := range []string{"old", "squashed", "rebased", "open"} {
+			git(root, "update-ref", "refs/remotes/origin/"+name, name)
+			git(root, "branch", "-q", "-D", name)
+		}
+		repo := clip.NewRepository(nativeBackend(root))
+
+		plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", Merge: clip.PlanMerged})
+		Expect(err).To(BeNil())
+		merged := map[string]string{}
+		for _, deletion := range plan.Deletions {
+			merged[deletion.Branch] = deletion.Merged
+		}
+		Expect(merged).To(Equal(map[string]string{
+			"old":      clip.MergedAncestor,
+			"squashed": clip.MergedSquash,
+			"rebased":  clip.MergedPatchID,
+		}))
+		Expect(plan.Deletions[0].Reason).To(Equal("no local branch and not tracked, merged into main (ancestor)"))
+
+		plan, err = repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", Merge: clip.PlanUnmerged})
+		Expect(err).To(BeNil())
+		Expect(plan.Deletions).To(HaveLen(1))
+		Expect(plan.Deletions[0].Branch).To(Equal("open"))
+		Expect(plan.Deletions[0].Ahead).To(Equal(2))
+		Expect(plan.Deletions[0].Reason).To(Equal("no local branch and not tracked, 2 commits not in main"))
+
+		// Only open is merged into itself
+		plan, err = repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", Merge: clip.PlanUnmerged,
+			MergedInto: "origin/open"})
+		Expect(err).To(BeNil())
+		Expect(plan.Deletions).To(HaveLen(3))
+
+		_, err = repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", Merge: "some"})
+		Expect(err).To(MatchError("unknown merge selection 'some'"))
+	})
+})
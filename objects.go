@@ -0,0 +1,646 @@
+package clip
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Git object types as stored in pack files
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var objTypeNames = map[int]string{
+	objCommit: "commit",
+	objTree:   "tree",
+	objBlob:   "blob",
+	objTag:    "tag",
+}
+
+// ErrObjectNotFound is returned when an object is in neither the loose objects or the packs
+var ErrObjectNotFound = errors.New("object not found")
+
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+type Commit struct {
+	Sha       string
+	Tree      string
+	Parents   []string
+	Author    Signature
+	Committer Signature
+	Message   string
+}
+
+// Subject returns the first line of the commit message
+func (c *Commit) Subject() string {
+	return strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0]
+}
+
+// ObjectStore reads objects directly from the loose objects and pack files of a repository.
+// It's safe for concurrent use.
+type ObjectStore struct {
+	dirs  []string
+	packs []*packFile
+	graph *commitGraph
+}
+
+// OpenObjectStore opens the object database at 'objectsDir' (usually `.git/objects`)
+// including any alternate object directories and the commit-graph if one exists.
+func OpenObjectStore(objectsDir string) (*ObjectStore, error) {
+	store := &ObjectStore{}
+	if err := store.addDir(objectsDir, 0); err != nil {
+		return nil, err
+	}
+	graph, err := openCommitGraph(filepath.Join(objectsDir, "info"))
+	if err != nil {
+		return nil, err
+	}
+	store.graph = graph
+	return store, nil
+}
+
+// addDir adds an objects directory and its alternates to the store
+func (s *ObjectStore) addDir(dir string, depth int) error {
+	// Git limits alternate chains to a depth of 5
+	if depth > 5 {
+		return nil
+	}
+	for _, existing := range s.dirs {
+		if existing == dir {
+			return nil
+		}
+	}
+	s.dirs = append(s.dirs, dir)
+
+	indexes, err := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+	if err != nil {
+		return errors.Wrap(err, "addDir()")
+	}
+	for _, idx := range indexes {
+		pack, err := openPackFile(idx)
+		if err != nil {
+			return err
+		}
+		s.packs = append(s.packs, pack)
+	}
+
+	alternates, err := ioutil.ReadFile(filepath.Join(dir, "info", "alternates"))
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(alternates), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(dir, line)
+		}
+		if err := s.addDir(filepath.Clean(line), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the pack files held open by the store
+func (s *ObjectStore) Close() error {
+	for _, pack := range s.packs {
+		pack.file.Close()
+	}
+	return nil
+}
+
+// ReadObject returns the type and contents of the object 'sha'
+func (s *ObjectStore) ReadObject(sha string) (string, []byte, error) {
+	id, err := hex.DecodeString(sha)
+	if err != nil || len(id) != 20 {
+		return "", nil, errors.Errorf("invalid object id '%s'", sha)
+	}
+
+	for _, pack := range s.packs {
+		offset, ok := pack.find(id)
+		if !ok {
+			continue
+		}
+		objType, data, err := pack.readAt(offset, s)
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "while reading '%s' from '%s'", sha, pack.path)
+		}
+		return objTypeNames[objType], data, nil
+	}
+
+	for _, dir := range s.dirs {
+		objType, data, err := readLooseObject(filepath.Join(dir, sha[:2], sha[2:]))
+		if err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				continue
+			}
+			return "", nil, errors.Wrapf(err, "while reading '%s'", sha)
+		}
+		return objType, data, nil
+	}
+	return "", nil, errors.Wrapf(ErrObjectNotFound, "'%s'", sha)
+}
+
+// ReadCommit returns the parsed commit 'sha'
+func (s *ObjectStore) ReadCommit(sha string) (*Commit, error) {
+	objType, data, err := s.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	if objType != "commit" {
+		return nil, errors.Errorf("object '%s' is a %s not a commit", sha, objType)
+	}
+	return ParseCommit(sha, data)
+}
+
+// ParseCommit parses the raw contents of a commit object
+func ParseCommit(sha string, data []byte) (*Commit, error) {
+	commit := &Commit{Sha: sha}
+	header := string(data)
+	if idx := strings.Index(header, "\n\n"); idx != -1 {
+		commit.Message = header[idx+2:]
+		header = header[:idx]
+	}
+
+	for _, line := range strings.Split(header, "\n") {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case "tree":
+			commit.Tree = parts[1]
+		case "parent":
+			commit.Parents = append(commit.Parents, parts[1])
+		case "author":
+			commit.Author = parseSignature(parts[1])
+		case "committer":
+			commit.Committer = parseSignature(parts[1])
+		}
+	}
+	if commit.Tree == "" {
+		return nil, errors.Errorf("commit '%s' has no tree", sha)
+	}
+	return commit, nil
+}
+
+// parseSignature parses `Name <email> 1234567890 +0000`
+func parseSignature(input string) Signature {
+	var sig Signature
+	open := strings.LastIndex(input, "<")
+	close := strings.LastIndex(input, ">")
+	if open == -1 || close < open {
+		sig.Name = input
+		return sig
+	}
+	sig.Name = strings.TrimSpace(input[:open])
+	sig.Email = input[open+1 : close]
+
+	fields := strings.Fields(input[close+1:])
+	if len(fields) == 0 {
+		return sig
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return sig
+	}
+	loc := time.UTC
+	if len(fields) > 1 && len(fields[1]) == 5 {
+		if tz, err := strconv.Atoi(fields[1][1:]); err == nil {
+			offset := (tz/100)*3600 + (tz%100)*60
+			if fields[1][0] == '-' {
+				offset = -offset
+			}
+			loc = time.FixedZone(fields[1], offset)
+		}
+	}
+	sig.When = time.Unix(seconds, 0).In(loc)
+	return sig
+}
+
+func readLooseObject(path string) (string, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "readLooseObject()")
+	}
+	defer file.Close()
+
+	reader, err := zlib.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return "", nil, errors.Wrap(err, "readLooseObject()")
+	}
+	defer reader.Close()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "readLooseObject()")
+	}
+	// The header is `<type> <size>\0`
+	idx := bytes.IndexByte(content, 0)
+	if idx == -1 {
+		return "", nil, errors.Errorf("corrupt loose object '%s'", path)
+	}
+	header := strings.SplitN(string(content[:idx]), " ", 2)
+	return header[0], content[idx+1:], nil
+}
+
+// packFile is a pack and its index
+type packFile struct {
+	path    string
+	file    *os.File
+	fanout  [256]uint32
+	ids     []byte
+	offsets []uint64
+}
+
+func openPackFile(idxPath string) (*packFile, error) {
+	idx, err := ioutil.ReadFile(idxPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "openPackFile()")
+	}
+	pack := &packFile{path: strings.TrimSuffix(idxPath, ".idx") + ".pack"}
+	if err := pack.parseIndex(idx); err != nil {
+		return nil, errors.Wrapf(err, "while reading '%s'", idxPath)
+	}
+	if pack.file, err = os.Open(pack.path); err != nil {
+		return nil, errors.Wrap(err, "openPackFile()")
+	}
+	return pack, nil
+}
+
+// parseIndex parses version 1 and 2 pack index files
+func (p *packFile) parseIndex(idx []byte) error {
+	fanoutAt := 0
+	version := 1
+	if len(idx) >= 8 && bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) {
+		version = int(binary.BigEndian.Uint32(idx[4:8]))
+		if version != 2 {
+			return errors.Errorf("unsupported pack index version %d", version)
+		}
+		fanoutAt = 8
+	}
+	if len(idx) < fanoutAt+256*4 {
+		return errors.New("pack index is truncated")
+	}
+	for i := 0; i < 256; i++ {
+		p.fanout[i] = binary.BigEndian.Uint32(idx[fanoutAt+i*4:])
+	}
+	count := int(p.fanout[255])
+	at := fanoutAt + 256*4
+
+	if version == 1 {
+		// Each entry is a 4 byte offset followed by the 20 byte id
+		if len(idx) < at+count*24 {
+			return errors.New("pack index is truncated")
+		}
+		p.ids = make([]byte, count*20)
+		p.offsets = make([]uint64, count)
+		for i := 0; i < count; i++ {
+			entry := idx[at+i*24:]
+			p.offsets[i] = uint64(binary.BigEndian.Uint32(entry))
+			copy(p.ids[i*20:], entry[4:24])
+		}
+		return nil
+	}
+
+	// Version 2 stores ids, crc32s, 4 byte offsets then 8 byte offsets in separate tables
+	idsAt := at
+	offsetsAt := idsAt + count*20 + count*4
+	largeAt := offsetsAt + count*4
+	if len(idx) < largeAt {
+		return errors.New("pack index is truncated")
+	}
+	p.ids = idx[idsAt : idsAt+count*20]
+	p.offsets = make([]uint64, count)
+	for i := 0; i < count; i++ {
+		offset := binary.BigEndian.Uint32(idx[offsetsAt+i*4:])
+		if offset&0x80000000 == 0 {
+			p.offsets[i] = uint64(offset)
+			continue
+		}
+		large := largeAt + int(offset&0x7fffffff)*8
+		if len(idx) < large+8 {
+			return errors.New("pack index is truncated")
+		}
+		p.offsets[i] = binary.BigEndian.Uint64(idx[large:])
+	}
+	return nil
+}
+
+// find returns the offset of the object 'id' in the pack
+func (p *packFile) find(id []byte) (uint64, bool) {
+	low := 0
+	if id[0] > 0 {
+		low = int(p.fanout[id[0]-1])
+	}
+	high := int(p.fanout[id[0]])
+	i := low + sort.Search(high-low, func(i int) bool {
+		return bytes.Compare(p.ids[(low+i)*20:(low+i)*20+20], id) >= 0
+	})
+	if i < high && bytes.Equal(p.ids[i*20:i*20+20], id) {
+		return p.offsets[i], true
+	}
+	return 0, false
+}
+
+// readAt reads the object at 'offset' resolving any deltas
+func (p *packFile) readAt(offset uint64, store *ObjectStore) (int, []byte, error) {
+	reader := bufio.NewReader(io.NewSectionReader(p.file, int64(offset), 1<<62))
+
+	// The header is a type and a variable length size
+	c, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	objType := int(c>>4) & 7
+	size := uint64(c & 0x0f)
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if c, err = reader.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+		size |= uint64(c&0x7f) << shift
+	}
+
+	switch objType {
+	case objCommit, objTree, objBlob, objTag:
+		data, err := inflate(reader, size)
+		return objType, data, err
+	case objOfsDelta:
+		c, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		distance := uint64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = reader.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			distance = ((distance + 1) << 7) | uint64(c&0x7f)
+		}
+		if distance > offset {
+			return 0, nil, errors.Errorf("invalid delta base offset at %d", offset)
+		}
+		delta, err := inflate(reader, size)
+		if err != nil {
+			return 0, nil, err
+		}
+		baseType, base, err := p.readAt(offset-distance, store)
+		if err != nil {
+			return 0, nil, err
+		}
+		data, err := applyDelta(base, delta)
+		return baseType, data, err
+	case objRefDelta:
+		id := make([]byte, 20)
+		if _, err := io.ReadFull(reader, id); err != nil {
+			return 0, nil, err
+		}
+		delta, err := inflate(reader, size)
+		if err != nil {
+			return 0, nil, err
+		}
+		var baseType int
+		var base []byte
+		if baseOffset, ok := p.find(id); ok {
+			if baseType, base, err = p.readAt(baseOffset, store); err != nil {
+				return 0, nil, err
+			}
+		} else {
+			// The base can be in another pack or a loose object in a thin pack
+			typeName, data, err := store.ReadObject(hex.EncodeToString(id))
+			if err != nil {
+				return 0, nil, err
+			}
+			for t, name := range objTypeNames {
+				if name == typeName {
+					baseType = t
+				}
+			}
+			base = data
+		}
+		data, err := applyDelta(base, delta)
+		return baseType, data, err
+	}
+	return 0, nil, errors.Errorf("unknown object type %d at offset %d", objType, offset)
+}
+
+func inflate(reader io.Reader, size uint64) ([]byte, error) {
+	zr, err := zlib.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(zr, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// applyDelta builds an object from its base and a git delta
+func applyDelta(base, delta []byte) ([]byte, error) {
+	pos := 0
+	readSize := func() uint64 {
+		var size uint64
+		for shift := uint(0); pos < len(delta); shift += 7 {
+			c := delta[pos]
+			pos++
+			size |= uint64(c&0x7f) << shift
+			if c&0x80 == 0 {
+				break
+			}
+		}
+		return size
+	}
+
+	if readSize() != uint64(len(base)) {
+		return nil, errors.New("delta base size mismatch")
+	}
+	size := readSize()
+	result := make([]byte, 0, size)
+
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+		switch {
+		case op&0x80 != 0:
+			// Copy a range from the base
+			var offset, size uint64
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 && pos < len(delta) {
+					offset |= uint64(delta[pos]) << (i * 8)
+					pos++
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(1<<(4+i)) != 0 && pos < len(delta) {
+					size |= uint64(delta[pos]) << (i * 8)
+					pos++
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errors.New("delta copy out of range")
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			// Insert the next 'op' bytes
+			if pos+int(op) > len(delta) {
+				return nil, errors.New("delta insert out of range")
+			}
+			result = append(result, delta[pos:pos+int(op)]...)
+			pos += int(op)
+		default:
+			return nil, errors.New("invalid delta opcode 0")
+		}
+	}
+	if uint64(len(result)) != size {
+		return nil, errors.New("delta result size mismatch")
+	}
+	return result, nil
+}
+
+// objectSource is a commitSource which reads commits from an ObjectStore, using the
+// commit-graph for parents and generation numbers when the commit is in the graph.
+type objectSource struct {
+	store   *ObjectStore
+	commits map[string]graphCommit
+	missing map[string]bool
+}
+
+// Commits not in the commit-graph are newer than every commit in it, so they are ordered
+// above the generation numbers of the graph
+const outsideGraphOrder = int64(1) << 40
+
+func newObjectSource(store *ObjectStore) *objectSource {
+	return &objectSource{
+		store:   store,
+		commits: map[string]graphCommit{},
+		missing: map[string]bool{},
+	}
+}
+
+func (s *objectSource) parents(sha string) ([]string, int64, bool, error) {
+	if commit, ok := s.commits[sha]; ok {
+		return commit.parents, commit.order, true, nil
+	}
+	if s.missing[sha] {
+		return nil, 0, false, nil
+	}
+
+	if s.store.graph != nil {
+		parents, generation, when, ok, err := s.store.graph.commit(sha)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		if ok {
+			order := when
+			if generation != 0 {
+				order = int64(generation)
+			}
+			s.commits[sha] = graphCommit{parents: parents, order: order}
+			return parents, order, true, nil
+		}
+	}
+
+	commit, err := s.store.ReadCommit(sha)
+	if err != nil {
+		// Commits missing from a shallow clone are treated as unknown
+		if errors.Cause(err) == ErrObjectNotFound {
+			s.missing[sha] = true
+			return nil, 0, false, nil
+		}
+		return nil, 0, false, err
+	}
+	order := commit.Committer.When.Unix()
+	if s.store.graph != nil {
+		order += outsideGraphOrder
+	}
+	s.commits[sha] = graphCommit{parents: commit.Parents, order: order}
+	return commit.Parents, order, true, nil
+}
+
+// checkTips returns an error if any of 'tips' is missing from the object store. Unlike a
+// parent missing from a shallow clone, walking from a missing tip would count it as 0/0.
+func (s *objectSource) checkTips(tips ...string) error {
+	for _, tip := range tips {
+		_, _, ok, err := s.parents(tip)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Wrapf(ErrObjectNotFound, "commit %s", tip)
+		}
+	}
+	return nil
+}
+
+// Objects returns the object store of the repository, opening it on first use
+func (b *NativeBackend) Objects() (*ObjectStore, error) {
+	b.objectsOnce.Do(func() {
+		b.objects, b.objectsErr = OpenObjectStore(filepath.Join(b.CommonDir, "objects"))
+	})
+	return b.objects, b.objectsErr
+}
+
+func (b *NativeBackend) AheadBehind(result AheadBehindMap, pairs []RevPair) error {
+	store, err := b.Objects()
+	if err == nil {
+		source := newObjectSource(store)
+		var tips []string
+		for _, pair := range pairs {
+			tips = append(tips, pair.Branch, pair.Base)
+		}
+		if err = source.checkTips(tips...); err == nil {
+			if err = walkAheadBehind(result, pairs, source); err == nil {
+				return nil
+			}
+		}
+	}
+	// Fall back to git for repositories we can't read, such as sha256 or partial clones,
+	// and to report tips missing from the object store
+	return b.ExecBackend.AheadBehind(result, pairs)
+}
+
+func (b *NativeBackend) CommitsBetween(commits *[]string, begin, end string) error {
+	if begin == end {
+		return nil
+	}
+	store, err := b.Objects()
+	if err == nil {
+		source := newObjectSource(store)
+		if err = source.checkTips(begin, end); err == nil {
+			if err = walkCommitsBetween(commits, begin, end, source); err == nil {
+				return nil
+			}
+		}
+	}
+	return b.ExecBackend.CommitsBetween(commits, begin, end)
+}
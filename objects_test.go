@@ -0,0 +1,143 @@
+package clip_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/thrawn01/clip"
+)
+
+// compareWithExec asserts the native backend counts the same commits as git does
+func compareWithExec(root string, shas map[string]string) {
+	native, err := clip.NewNativeBackend(root)
+	Expect(err).To(BeNil())
+	exec := clip.NewExecBackend(root)
+
+	var pairs []clip.RevPair
+	for _, branch := range shas {
+		for _, base := range shas {
+			pairs = append(pairs, clip.RevPair{Branch: branch, Base: base})
+		}
+	}
+	expected, counts := clip.AheadBehindMap{}, clip.AheadBehindMap{}
+	Expect(exec.AheadBehind(expected, pairs)).To(Succeed())
+	Expect(native.AheadBehind(counts, pairs)).To(Succeed())
+	Expect(counts).To(Equal(expected))
+
+	for _, pair := range pairs {
+		var want, got []string
+		Expect(exec.CommitsBetween(&want, pair.Base, pair.Branch)).To(Succeed())
+		Expect(native.CommitsBetween(&got, pair.Base, pair.Branch)).To(Succeed())
+		sort.Strings(want)
+		sort.Strings(got)
+		Expect(got).To(Equal(want), "%s..%s", pair.Base, pair.Branch)
+	}
+}
+
+var _ = Describe("ObjectStore", func() {
+	var root string
+	var shas map[string]string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-objects")
+		Expect(err).To(BeNil())
+		shas = newHistoryRepo(root)
+
+		// Similar file contents give `git gc` something to delta compress
+		var content string
+		for i := 0; i < 200; i++ {
+			content += fmt.Sprintf("line %d\n", i)
+		}
+		for i := 0; i < 3; i++ {
+			content += fmt.Sprintf("change %d\n", i)
+			writeFile(filepath.Join(root, "file.txt"), content)
+			git(root, "add", "file.txt")
+			git(root, "commit", "-q", "-m", fmt.Sprintf("change %d", i))
+		}
+		shas["master"] = strings.TrimSpace(git(root, "rev-parse", "master"))
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Should read loose commits", func() {
+		store, err := clip.OpenObjectStore(filepath.Join(root, ".git", "objects"))
+		Expect(err).To(BeNil())
+		defer store.Close()
+
+		commit, err := store.ReadCommit(shas["master"])
+		Expect(err).To(BeNil())
+		Expect(commit.Sha).To(Equal(shas["master"]))
+		Expect(commit.Subject()).To(Equal("change 2"))
+		Expect(commit.Author.Name).To(Equal("Clip"))
+		Expect(commit.Committer.Email).To(Equal("clip@example.com"))
+		Expect(commit.Parents).To(Equal([]string{
+			strings.TrimSpace(git(root, "rev-parse", "master~1")),
+		}))
+		Expect(commit.Tree).To(Equal(strings.TrimSpace(git(root, "rev-parse", "master^{tree}"))))
+	})
+
+	It("Should read delta compressed objects from packs", func() {
+		git(root, "gc", "-q", "--aggressive")
+		store, err := clip.OpenObjectStore(filepath.Join(root, ".git", "objects"))
+		Expect(err).To(BeNil())
+		defer store.Close()
+
+		for _, rev := range []string{"master:file.txt", "master~1:file.txt", "master~2:file.txt"} {
+			sha := strings.TrimSpace(git(root, "rev-parse", rev))
+			kind, data, err := store.ReadObject(sha)
+			Expect(err).To(BeNil())
+			Expect(kind).To(Equal("blob"))
+			Expect(string(data)).To(Equal(git(root, "cat-file", "blob", sha)))
+		}
+		_, _, err = store.ReadObject(strings.Repeat("0", 40))
+		Expect(errors.Cause(err)).To(Equal(clip.ErrObjectNotFound))
+	})
+
+	It("Should fail to count a tip missing from the object store", func() {
+		native, err := clip.NewNativeBackend(root)
+		Expect(err).To(BeNil())
+
+		missing := strings.Repeat("1", 40)
+		pairs := []clip.RevPair{{Branch: missing, Base: shas["master"]}}
+		Expect(native.AheadBehind(clip.AheadBehindMap{}, pairs)).NotTo(Succeed())
+		var commits []string
+		Expect(native.CommitsBetween(&commits, shas["master"], missing)).NotTo(Succeed())
+	})
+
+	It("Should walk loose objects like git", func() {
+		compareWithExec(root, shas)
+	})
+
+	It("Should walk packed objects like git", func() {
+		git(root, "gc", "-q")
+		compareWithExec(root, shas)
+	})
+
+	It("Should walk the commit-graph like git", func() {
+		git(root, "gc", "-q")
+		git(root, "commit-graph", "write", "--reachable")
+		// Commits newer than the commit-graph are read from the object store
+		git(root, "commit", "-q", "--allow-empty", "-m", "after graph")
+		shas["master"] = strings.TrimSpace(git(root, "rev-parse", "master"))
+		compareWithExec(root, shas)
+	})
+
+	It("Should walk a split commit-graph like git", func() {
+		git(root, "commit-graph", "write", "--reachable", "--split")
+		git(root, "checkout", "-q", "feature")
+		git(root, "commit", "-q", "--allow-empty", "-m", "feature three")
+		git(root, "commit-graph", "write", "--reachable", "--split=no-merge")
+		shas["feature"] = strings.TrimSpace(git(root, "rev-parse", "feature"))
+		compareWithExec(root, shas)
+	})
+})
@@ -0,0 +1,413 @@
+package clip
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PlanVersion is the version of the plan file format
+const PlanVersion = 1
+
+// Plan is the set of remote branches clip-remote will delete
+type Plan struct {
+	Version   int        `json:"version"`
+	Remote    string     `json:"remote"`
+	Created   time.Time  `json:"created"`
+	Deletions []Deletion `json:"deletions"`
+	// Protected are the branches which would be deleted if not for a protect rule
+	Protected []Protected `json:"protected,omitempty"`
+}
+
+// Deletion is a remote branch planned for deletion along with the commit it points to
+type Deletion struct {
+	Remote string    `json:"remote"`
+	Branch string    `json:"branch"`
+	Sha    string    `json:"sha"`
+	Date   time.Time `json:"date"`
+	Author string    `json:"author"`
+	Reason string    `json:"reason"`
+	// Merged is how the branch was merged when planned with PlanOpts.Merge, one of the
+	// Merged constants or empty if the branch is not merged
+	Merged string `json:"merged,omitempty"`
+	// Ahead is the number of commits not merged when planned with PlanOpts.Merge
+	Ahead int `json:"ahead,omitempty"`
+}
+
+// Protected is a branch kept by a protect rule
+type Protected struct {
+	Remote  string `json:"remote"`
+	Branch  string `json:"branch"`
+	Pattern string `json:"pattern"`
+	Source  string `json:"source"`
+}
+
+// Select branches by whether they are merged with PlanOpts.Merge
+const (
+	PlanMerged   = "merged"
+	PlanUnmerged = "unmerged"
+)
+
+// PlanOpts selects the remote branches PlanRemoteDeletions() considers
+type PlanOpts struct {
+	Remote string
+	// Only branches with this prefix are planned
+	Prefix string
+	// If not zero only branches whose tip was committed before OlderThan are planned
+	OlderThan time.Time
+	// If not zero only branches whose tip was committed after NewerThan are planned
+	NewerThan time.Time
+	// If not nil only branches authored by a matching author are planned, see AuthoredBy()
+	Author *AuthorFilter
+	// Merge selects only branches merged into MergedInto with PlanMerged, or only those
+	// with commits MergedInto does not have with PlanUnmerged. See MergedInto().
+	Merge string
+	// MergedInto is the branch Merge is checked against, defaults to the trunk
+	MergedInto string
+	// Trunk is the branch used to find the commits unique to a branch, see ResolveTrunk()
+	Trunk string
+}
+
+// PlanRemoteDeletions plans the deletion of every branch on the remote which has no local
+// branch of the same name and is not tracked by a local branch
+func (r *Repository) PlanRemoteDeletions(opts PlanOpts) (*Plan, error) {
+	refs := BranchReferenceMap{}
+	tracked := TrackedBranchMap{}
+
+	// List remote and local branches
+	if err := r.ListBranchRefs(refs); err != nil {
+		return nil, err
+	}
+
+	// List tracked local branches
+	if err := r.ListTrackedBranches(tracked); err != nil {
+		return nil, err
+	}
+
+	// Find remote branches that do not have local branches and are not tracked
+	branches, ok := refs[opts.Remote]
+	if !ok {
+		return nil, errors.Errorf("No such remote named '%s'", opts.Remote)
+	}
+
+	policy, err := r.LoadPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	// Describe the last commit of each branch so the plan can be reviewed
+	if err := r.LoadCommits(BranchReferenceMap{opts.Remote: branches}); err != nil {
+		return nil, err
+	}
+
+	if opts.Merge != PlanMerged && opts.Merge != PlanUnmerged && opts.Merge != "" {
+		return nil, errors.Errorf("unknown merge selection '%s'", opts.Merge)
+	}
+
+	// Commits unique to a branch are those the trunk does not have
+	var trunk *Trunk
+	if opts.Author != nil || (opts.Merge != "" && opts.MergedInto == "") {
+		if trunk, err = r.ResolveTrunk(opts.Trunk, refs); err != nil {
+			return nil, err
+		}
+	}
+	var into *Branch
+	switch {
+	case opts.Merge != "" && opts.MergedInto != "":
+		if into, err = ResolveBase(opts.MergedInto, refs); err != nil {
+			return nil, err
+		}
+	case opts.Merge != "":
+		into = trunk.Branch
+	}
+
+	// Branches which pass every filter but the merge selection
+	type candidate struct {
+		branch *Branch
+		reason string
+	}
+	var candidates []candidate
+
+	plan := &Plan{Version: PlanVersion, Remote: opts.Remote, Created: time.Now().UTC()}
+	for _, branch := range branches {
+		if branch.Name == "HEAD" {
+			continue
+		}
+
+		// Does this branch exist locally?
+		if ExistsLocally(branch, refs) {
+			continue
+		}
+
+		// Is this branch tracking a remote branch?
+		if IsTracked(branch, opts.Remote, tracked) {
+			continue
+		}
+
+		if !ExistsRemotely(branch, opts.Remote, refs) {
+			continue
+		}
+
+		// Is this branch name prefixed with something?
+		reason := "no local branch and not tracked"
+		if opts.Prefix != "" {
+			if !strings.HasPrefix(branch.Name, opts.Prefix) {
+				continue
+			}
+			reason += ", matches prefix '" + opts.Prefix + "'"
+		}
+
+		// The age of branches whose commit is missing is unknown
+		if !opts.OlderThan.IsZero() {
+			if branch.Commit == nil || !branch.Commit.Committer.When.Before(opts.OlderThan) {
+				continue
+			}
+			reason += ", committed before " + opts.OlderThan.Format("2006-01-02")
+		}
+		if !opts.NewerThan.IsZero() {
+			if branch.Commit == nil || !branch.Commit.Committer.When.After(opts.NewerThan) {
+				continue
+			}
+			reason += ", committed after " + opts.NewerThan.Format("2006-01-02")
+		}
+
+		// Protected branches are never deleted, skip the author and merge checks for them
+		if rule := policy.Protected(branch.Name); rule != nil {
+			plan.Protected = append(plan.Protected, Protected{
+				Remote:  opts.Remote,
+				Branch:  branch.Name,
+				Pattern: rule.Pattern,
+				Source:  rule.Source,
+			})
+			continue
+		}
+
+		if opts.Author != nil {
+			ok, err := r.AuthoredBy(opts.Author, branch, trunk.Branch)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			reason += ", authored by '" + opts.Author.Pattern + "'"
+		}
+
+		candidates = append(candidates, candidate{branch: branch, reason: reason})
+	}
+
+	// Check how every candidate was merged at once, see MergedIntoAll()
+	merged, ahead := map[string]string{}, map[string]int{}
+	if into != nil {
+		var tips []*Branch
+		for _, candidate := range candidates {
+			tips = append(tips, candidate.branch)
+		}
+		if err := r.mergedInto(merged, ahead, tips, into); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, candidate := range candidates {
+		branch, reason := candidate.branch, candidate.reason
+		if into != nil {
+			how := merged[branch.Sha]
+			if (opts.Merge == PlanMerged) != (how != "") {
+				continue
+			}
+			if how != "" {
+				reason += ", merged into " + into.Name + " (" + how + ")"
+			} else {
+				reason += ", " + strconv.Itoa(ahead[branch.Sha]) + " commits not in " + into.Name
+			}
+		}
+
+		deletion := Deletion{
+			Remote: opts.Remote,
+			Branch: branch.Name,
+			Sha:    branch.Sha,
+			Reason: reason,
+			Merged: merged[branch.Sha],
+			Ahead:  ahead[branch.Sha],
+		}
+		if branch.Commit != nil {
+			deletion.Date = branch.Commit.Committer.When
+			deletion.Author = branch.Commit.Author.Name + " <" + branch.Commit.Author.Email + ">"
+		}
+		plan.Deletions = append(plan.Deletions, deletion)
+	}
+	sort.Slice(plan.Deletions, func(i, j int) bool {
+		return plan.Deletions[i].Branch < plan.Deletions[j].Branch
+	})
+	sort.Slice(plan.Protected, func(i, j int) bool {
+		return plan.Protected[i].Branch < plan.Protected[j].Branch
+	})
+
+	return plan, nil
+}
+
+// mergedInto adds how each of 'branches' was merged into 'into' to 'merged' and, for those
+// not merged, the number of commits 'into' does not have to 'ahead'. Both are keyed by sha.
+func (r *Repository) mergedInto(merged map[string]string, ahead map[string]int, branches []*Branch,
+	into *Branch) error {
+
+	var pairs []RevPair
+	for _, branch := range branches {
+		pairs = append(pairs, RevPair{Branch: branch.Sha, Base: into.Sha})
+	}
+	counts := AheadBehindMap{}
+	if err := r.AheadBehind(counts, pairs); err != nil {
+		return err
+	}
+	var shas []string
+	for _, pair := range pairs {
+		if counts[pair].Ahead == 0 {
+			merged[pair.Branch] = MergedAncestor
+			continue
+		}
+		shas = append(shas, pair.Branch)
+	}
+	if err := r.MergedIntoAll(merged, shas, into.Sha); err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if merged[pair.Branch] == "" {
+			ahead[pair.Branch] = counts[pair].Ahead
+		}
+	}
+	return nil
+}
+
+// VerifyPlan returns an error if any branch in 'plan' no longer points to the sha it
+// pointed to when planned, no longer exists or is now protected. Branches are checked on
+// the remote itself as the remote branches in the repository may be out of date.
+func (r *Repository) VerifyPlan(plan *Plan) error {
+	policy, err := r.LoadPolicy()
+	if err != nil {
+		return err
+	}
+	var protected []string
+	for _, deletion := range plan.Deletions {
+		if rule := policy.Protected(deletion.Branch); rule != nil {
+			protected = append(protected, deletion.Remote+"/"+deletion.Branch+" ("+rule.Pattern+")")
+		}
+	}
+	if len(protected) != 0 {
+		return errors.Errorf("refusing to apply plan; branches are protected: %s",
+			strings.Join(protected, ", "))
+	}
+
+	// Ask each remote for the current sha of its branches
+	var remotes []string
+	byRemote := map[string][]string{}
+	for _, deletion := range plan.Deletions {
+		if _, ok := byRemote[deletion.Remote]; !ok {
+			remotes = append(remotes, deletion.Remote)
+		}
+		byRemote[deletion.Remote] = append(byRemote[deletion.Remote], deletion.Branch)
+	}
+	live := map[string]map[string]string{}
+	for _, remote := range remotes {
+		live[remote] = map[string]string{}
+		if err := r.Backend.ListRemoteBranches(live[remote], remote, byRemote[remote]); err != nil {
+			return err
+		}
+	}
+
+	var moved []string
+	for _, deletion := range plan.Deletions {
+		sha, ok := live[deletion.Remote][deletion.Branch]
+		if !ok {
+			moved = append(moved, deletion.Remote+"/"+deletion.Branch+" (deleted)")
+			continue
+		}
+		if sha != deletion.Sha {
+			moved = append(moved, deletion.Remote+"/"+deletion.Branch+" (now "+sha+")")
+		}
+	}
+	if len(moved) != 0 {
+		return errors.Errorf("refusing to apply plan; branches changed since planning: %s",
+			strings.Join(moved, ", "))
+	}
+	return nil
+}
+
+func (b *ExecBackend) ListRemoteBranches(result map[string]string, remote string, branches []string) error {
+	if len(branches) == 0 {
+		return nil
+	}
+	args := []string{"ls-remote", remote}
+	for _, branch := range branches {
+		args = append(args, "refs/heads/"+branch)
+	}
+	var output string
+	if err := b.git(&output, args...); err != nil {
+		return errors.Wrap(err, "ListRemoteBranches()")
+	}
+	return ParseLsRemote(result, output, branches)
+}
+
+// ParseLsRemote adds the sha of each of 'branches' listed in the output of `git ls-remote`
+// to 'result'. The patterns given to `git ls-remote` match the end of a ref so refs other
+// than the branches asked for are left out.
+func ParseLsRemote(result map[string]string, output string, branches []string) error {
+	wanted := map[string]bool{}
+	for _, branch := range branches {
+		wanted[branch] = true
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 || !isSha(fields[0]) {
+			return errors.Errorf("unexpected 'git ls-remote' output '%s'", line)
+		}
+		name := strings.TrimPrefix(fields[1], "refs/heads/")
+		if name != fields[1] && wanted[name] {
+			result[name] = fields[0]
+		}
+	}
+	return nil
+}
+
+// WritePlan writes 'plan' to the file 'path' as JSON
+func WritePlan(path string, plan *Plan) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// Keep the `<email>` of authors readable
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(plan); err != nil {
+		return errors.Wrap(err, "WritePlan()")
+	}
+	return errors.Wrap(ioutil.WriteFile(path, buf.Bytes(), 0644), "WritePlan()")
+}
+
+// ReadPlan reads a plan written by WritePlan()
+func ReadPlan(path string) (*Plan, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadPlan()")
+	}
+	var plan Plan
+	if err := json.Unmarshal(content, &plan); err != nil {
+		return nil, errors.Wrapf(err, "while parsing plan '%s'", path)
+	}
+	if plan.Version != PlanVersion {
+		return nil, errors.Errorf("unsupported plan version %d in '%s'", plan.Version, path)
+	}
+	for _, deletion := range plan.Deletions {
+		if deletion.Remote == "" || deletion.Branch == "" || !isSha(deletion.Sha) {
+			return nil, errors.Errorf("invalid deletion '%s/%s' in plan '%s'",
+				deletion.Remote, deletion.Branch, path)
+		}
+	}
+	return &plan, nil
+}
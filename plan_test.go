@@ -0,0 +1,225 @@
+package clip_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+const shaFixVersion = "ac0ff092a6bd193fe73660a8f0302e5ed32911dc"
+
+var _ = Describe("Plan", func() {
+	var backend *fakeBackend
+	var repo *clip.Repository
+	var when time.Time
+
+	BeforeEach(func() {
+		when = time.Date(2018, 4, 1, 12, 0, 0, 0, time.UTC)
+		backend = &fakeBackend{config: gitConfigNull, refs: gitShowRef, commits: map[string]*clip.Commit{
+			shaFixVersion: {
+				Sha:       shaFixVersion,
+				Author:    clip.Signature{Name: "Clip", Email: "clip@example.com"},
+				Committer: clip.Signature{When: when},
+			},
+		}}
+		repo = clip.NewRepository(backend)
+	})
+
+	Describe("PlanRemoteDeletions()", func() {
+		It("Should plan branches with no local or tracking branch", func() {
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin"})
+			Expect(err).To(BeNil())
+			Expect(plan.Version).To(Equal(clip.PlanVersion))
+			Expect(plan.Deletions).To(Equal([]clip.Deletion{{
+				Remote: "origin",
+				Branch: "fix-version",
+				Sha:    shaFixVersion,
+				Date:   when,
+				Author: "Clip <clip@example.com>",
+				Reason: "no local branch and not tracked",
+			}}))
+		})
+		It("Should only plan branches with the prefix", func() {
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", Prefix: "re-"})
+			Expect(err).To(BeNil())
+			Expect(plan.Deletions).To(BeEmpty())
+		})
+		It("Should only plan branches older or newer than a date", func() {
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", OlderThan: when.AddDate(0, 0, 1)})
+			Expect(err).To(BeNil())
+			Expect(plan.Deletions).To(HaveLen(1))
+			Expect(plan.Deletions[0].Reason).To(Equal("no local branch and not tracked, committed before 2018-04-02"))
+
+			plan, err = repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", OlderThan: when})
+			Expect(err).To(BeNil())
+			Expect(plan.Deletions).To(BeEmpty())
+
+			plan, err = repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", NewerThan: when.AddDate(0, 0, -1)})
+			Expect(err).To(BeNil())
+			Expect(plan.Deletions).To(HaveLen(1))
+
+			plan, err = repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", NewerThan: when})
+			Expect(err).To(BeNil())
+			Expect(plan.Deletions).To(BeEmpty())
+		})
+		It("Should not plan branches of unknown age", func() {
+			delete(backend.commits, shaFixVersion)
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin", OlderThan: when.AddDate(1, 0, 0)})
+			Expect(err).To(BeNil())
+			Expect(plan.Deletions).To(BeEmpty())
+		})
+		It("Should error if the remote does not exist", func() {
+			_, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "nope"})
+			Expect(err).To(MatchError("No such remote named 'nope'"))
+		})
+	})
+
+	Describe("LoadCommits()", func() {
+		It("Should set the tip commit of every branch", func() {
+			refs := clip.BranchReferenceMap{}
+			Expect(repo.ListBranchRefs(refs)).To(Succeed())
+			Expect(repo.LoadCommits(refs)).To(Succeed())
+			Expect(refs["origin"]["fix-version"].Commit.Committer.When).To(Equal(when))
+			Expect(refs["local"]["master"].Commit).To(BeNil())
+		})
+	})
+
+	Describe("ParseAge()", func() {
+		It("Should parse days, weeks, years and durations", func() {
+			for age, expected := range map[string]time.Duration{
+				"90d": 90 * 24 * time.Hour,
+				"2w":  14 * 24 * time.Hour,
+				"1y":  365 * 24 * time.Hour,
+				"36h": 36 * time.Hour,
+			} {
+				duration, err := clip.ParseAge(age)
+				Expect(err).To(BeNil())
+				Expect(duration).To(Equal(expected))
+			}
+		})
+		It("Should reject invalid ages", func() {
+			_, err := clip.ParseAge("six months")
+			Expect(err).To(MatchError("invalid age 'six months'; expected a number of days like '90d'"))
+			_, err = clip.ParseAge("-3d")
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+	Describe("VerifyPlan()", func() {
+		It("Should refuse plans whose branches moved", func() {
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin"})
+			Expect(err).To(BeNil())
+			Expect(repo.VerifyPlan(plan)).To(Succeed())
+
+			backend.refs = strings.Replace(gitShowRef, shaFixVersion+" refs/remotes/origin/fix-version",
+				shaFix+" refs/remotes/origin/fix-version", 1)
+			err = repo.VerifyPlan(plan)
+			Expect(err).To(MatchError("refusing to apply plan; branches changed since planning: " +
+				"origin/fix-version (now " + shaFix + ")"))
+		})
+
+		It("Should check the branches on the remote instead of the remote branches", func() {
+			root, err := ioutil.TempDir("", "clip-verify")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(root)
+
+			remote := filepath.Join(root, "remote.git")
+			work := filepath.Join(root, "work")
+			Expect(os.MkdirAll(work, 0755)).To(Succeed())
+			git(root, "init", "-q", "--bare", remote)
+			git(work, "init", "-q", "-b", "main")
+			git(work, "commit", "-q", "--allow-empty", "-m", "init")
+			git(work, "remote", "add", "origin", remote)
+			git(work, "push", "-q", "-u", "origin", "main", "main:stale")
+
+			backend, err := clip.NewNativeBackend(work)
+			Expect(err).To(BeNil())
+			repo := clip.NewRepository(backend)
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin"})
+			Expect(err).To(BeNil())
+			Expect(plan.Deletions).To(HaveLen(1))
+			Expect(repo.VerifyPlan(plan)).To(Succeed())
+
+			// Someone else moves 'stale' without the repository fetching it
+			git(work, "commit", "-q", "--allow-empty", "-m", "next")
+			sha := strings.TrimSpace(git(work, "rev-parse", "main"))
+			git(work, "push", "-q", "origin", "main")
+			git(remote, "update-ref", "refs/heads/stale", sha)
+
+			err = repo.VerifyPlan(plan)
+			Expect(err).To(MatchError("refusing to apply plan; branches changed since planning: " +
+				"origin/stale (now " + sha + ")"))
+		})
+	})
+
+	Describe("ReadPlan()", func() {
+		var root string
+
+		BeforeEach(func() {
+			var err error
+			root, err = ioutil.TempDir("", "clip-plan")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(root)
+		})
+
+		It("Should read the plan written by WritePlan()", func() {
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin"})
+			Expect(err).To(BeNil())
+			path := filepath.Join(root, "plan.json")
+			Expect(clip.WritePlan(path, plan)).To(Succeed())
+
+			read, err := clip.ReadPlan(path)
+			Expect(err).To(BeNil())
+			Expect(read.Deletions).To(Equal(plan.Deletions))
+		})
+		It("Should refuse unknown versions", func() {
+			path := filepath.Join(root, "plan.json")
+			writeFile(path, `{"version": 2, "deletions": []}`)
+			_, err := clip.ReadPlan(path)
+			Expect(err).NotTo(BeNil())
+			Expect(err.Error()).To(ContainSubstring("unsupported plan version 2"))
+		})
+	})
+})
+
+var _ = Describe("LookupCommits()", func() {
+	It("Should parse `git cat-file --batch` output", func() {
+		commit := "tree " + shaTag + "\nparent " + shaFix + "\n" +
+			"author Clip <clip@example.com> 1522584000 +0200\n" +
+			"committer Clip <clip@example.com> 1522584000 +0200\n\nsubject\n"
+		input := shaMaster + " commit " + strconv.Itoa(len(commit)) + "\n" + commit + "\n" +
+			shaLoose + " missing\n" +
+			shaTag + " tree 0\n\n"
+
+		result := map[string]*clip.Commit{}
+		Expect(clip.ParseCatFileBatch(result, input)).To(Succeed())
+		Expect(len(result)).To(Equal(1))
+		Expect(result[shaMaster].Parents).To(Equal([]string{shaFix}))
+		Expect(result[shaMaster].Subject()).To(Equal("subject"))
+		Expect(result[shaMaster].Committer.When.Unix()).To(Equal(int64(1522584000)))
+	})
+
+	It("Should find the same commits as git", func() {
+		root, err := ioutil.TempDir("", "clip-commits")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(root)
+		shas := newHistoryRepo(root)
+
+		list := []string{shas["master"], shas["feature"], strings.Repeat("0", 40)}
+		expected, result := map[string]*clip.Commit{}, map[string]*clip.Commit{}
+		Expect(clip.NewExecBackend(root).LookupCommits(expected, list)).To(Succeed())
+		Expect(nativeBackend(root).LookupCommits(result, list)).To(Succeed())
+		Expect(len(result)).To(Equal(2))
+		Expect(result).To(Equal(expected))
+	})
+})
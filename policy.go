@@ -0,0 +1,144 @@
+package clip
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ClipFileName is the name of the repository level config file in the root of the work tree
+const ClipFileName = ".clip.yml"
+
+// ProtectFromConfig is the source of rules given with `clip.protect`
+const ProtectFromConfig = "clip.protect"
+
+// ProtectRule protects branches whose name matches Pattern, see CompilePattern(). IE:
+// `release/*` or `/^release-[0-9]+$/`
+type ProtectRule struct {
+	Pattern string
+	// Source is where the rule was configured, `clip.protect` or the path of a `.clip.yml`
+	Source string
+	regex  *regexp.Regexp
+}
+
+// NewProtectRule compiles 'pattern' configured in 'source'
+func NewProtectRule(pattern, source string) (*ProtectRule, error) {
+	regex, err := CompilePattern(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid protect pattern '%s' in %s", pattern, source)
+	}
+	return &ProtectRule{Pattern: pattern, Source: source, regex: regex}, nil
+}
+
+// CompilePattern compiles a branch name pattern, either a glob where `*` matches any
+// characters including `/` and `?` matches a single character, or a regular expression
+// wrapped in slashes
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	expr := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern)) + "$"
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr = pattern[1 : len(pattern)-1]
+	}
+	return regexp.Compile(expr)
+}
+
+// Match returns true if 'branch' is protected by the rule
+func (p *ProtectRule) Match(branch string) bool {
+	return p.regex.MatchString(branch)
+}
+
+// Policy decides which branches clip may delete
+type Policy struct {
+	Rules []*ProtectRule
+}
+
+// Protected returns the first rule that protects 'branch' or nil if the branch is not protected
+func (p *Policy) Protected(branch string) *ProtectRule {
+	for _, rule := range p.Rules {
+		if rule.Match(branch) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// ClipFile is the content of `.clip.yml`
+type ClipFile struct {
+	// Protect is a list of patterns for branches clip should never delete
+	Protect []string `yaml:"protect"`
+}
+
+// ReadClipFile reads the `.clip.yml` at 'path', a missing file is an empty config
+func ReadClipFile(path string) (*ClipFile, error) {
+	var file ClipFile
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &file, nil
+		}
+		return nil, errors.Wrap(err, "ReadClipFile()")
+	}
+	if err := yaml.UnmarshalStrict(content, &file); err != nil {
+		return nil, errors.Wrapf(err, "while parsing '%s'", path)
+	}
+	return &file, nil
+}
+
+// LoadPolicy reads the protect rules given with `clip.protect`, which may be given more than
+// once, and those in the `.clip.yml` at the root of the work tree
+func (r *Repository) LoadPolicy() (*Policy, error) {
+	config := Config{}
+	if err := r.Backend.ListConfig(config, `^clip\.protect$`); err != nil {
+		return nil, err
+	}
+	patterns := config.GetAll(ProtectFromConfig)
+	sources := make([]string, len(patterns))
+	for idx := range sources {
+		sources[idx] = ProtectFromConfig
+	}
+
+	workTree, err := r.Backend.WorkTree()
+	if err != nil {
+		return nil, err
+	}
+	// Bare repositories have no `.clip.yml`
+	if workTree != "" {
+		path := filepath.Join(workTree, ClipFileName)
+		file, err := ReadClipFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, pattern := range file.Protect {
+			patterns = append(patterns, pattern)
+			sources = append(sources, path)
+		}
+	}
+
+	policy := &Policy{}
+	for idx, pattern := range patterns {
+		rule, err := NewProtectRule(pattern, sources[idx])
+		if err != nil {
+			return nil, err
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+	return policy, nil
+}
+
+func (b *ExecBackend) WorkTree() (string, error) {
+	var output string
+	if err := b.git(&output, "rev-parse", "--is-bare-repository"); err != nil {
+		return "", errors.Wrap(err, "WorkTree()")
+	}
+	if strings.TrimSpace(output) == "true" {
+		return "", nil
+	}
+	if err := b.git(&output, "rev-parse", "--show-toplevel"); err != nil {
+		return "", errors.Wrap(err, "WorkTree()")
+	}
+	return strings.TrimSpace(output), nil
+}
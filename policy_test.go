@@ -0,0 +1,98 @@
+package clip_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var _ = Describe("Policy", func() {
+	var backend *fakeBackend
+	var repo *clip.Repository
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-policy")
+		Expect(err).To(BeNil())
+		backend = &fakeBackend{config: gitConfigNull, refs: gitShowRef, workTree: root}
+		repo = clip.NewRepository(backend)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	Describe("NewProtectRule()", func() {
+		It("Should match globs across slashes", func() {
+			rule, err := clip.NewProtectRule("release/*", clip.ProtectFromConfig)
+			Expect(err).To(BeNil())
+			Expect(rule.Match("release/1.0")).To(Equal(true))
+			Expect(rule.Match("release/1.0/fix")).To(Equal(true))
+			Expect(rule.Match("pre-release/1.0")).To(Equal(false))
+
+			rule, err = clip.NewProtectRule("gh-page?", clip.ProtectFromConfig)
+			Expect(err).To(BeNil())
+			Expect(rule.Match("gh-pages")).To(Equal(true))
+			Expect(rule.Match("gh-pages-old")).To(Equal(false))
+		})
+		It("Should match regular expressions wrapped in slashes", func() {
+			rule, err := clip.NewProtectRule(`/^hotfix-[0-9]+$/`, clip.ProtectFromConfig)
+			Expect(err).To(BeNil())
+			Expect(rule.Match("hotfix-12")).To(Equal(true))
+			Expect(rule.Match("hotfix-abc")).To(Equal(false))
+		})
+		It("Should error on invalid regular expressions", func() {
+			_, err := clip.NewProtectRule(`/hotfix-(/`, clip.ProtectFromConfig)
+			Expect(err).To(Not(BeNil()))
+			Expect(err.Error()).To(HavePrefix("invalid protect pattern '/hotfix-(/' in clip.protect"))
+		})
+	})
+
+	Describe("LoadPolicy()", func() {
+		It("Should read rules from git config and .clip.yml", func() {
+			backend.config += "clip.protect\nrelease/*\x00clip.protect\ngh-pages\x00"
+			writeFile(filepath.Join(root, clip.ClipFileName), "protect:\n  - /^hotfix-/\n")
+
+			policy, err := repo.LoadPolicy()
+			Expect(err).To(BeNil())
+			Expect(len(policy.Rules)).To(Equal(3))
+			Expect(policy.Protected("gh-pages").Source).To(Equal(clip.ProtectFromConfig))
+			rule := policy.Protected("hotfix-1")
+			Expect(rule.Pattern).To(Equal("/^hotfix-/"))
+			Expect(rule.Source).To(Equal(filepath.Join(root, clip.ClipFileName)))
+			Expect(policy.Protected("feature")).To(BeNil())
+		})
+		It("Should reject unknown keys in .clip.yml", func() {
+			writeFile(filepath.Join(root, clip.ClipFileName), "protected:\n  - main\n")
+			_, err := repo.LoadPolicy()
+			Expect(err).To(Not(BeNil()))
+		})
+		It("Should keep protected branches out of the plan", func() {
+			backend.config += "clip.protect\nfix-*\x00"
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin"})
+			Expect(err).To(BeNil())
+			Expect(plan.Deletions).To(BeEmpty())
+			Expect(plan.Protected).To(Equal([]clip.Protected{{
+				Remote:  "origin",
+				Branch:  "fix-version",
+				Pattern: "fix-*",
+				Source:  clip.ProtectFromConfig,
+			}}))
+		})
+		It("Should refuse to apply plans with protected branches", func() {
+			plan, err := repo.PlanRemoteDeletions(clip.PlanOpts{Remote: "origin"})
+			Expect(err).To(BeNil())
+			Expect(plan.Deletions).To(HaveLen(1))
+
+			writeFile(filepath.Join(root, clip.ClipFileName), "protect: [fix-version]\n")
+			err = repo.VerifyPlan(plan)
+			Expect(err).To(MatchError("refusing to apply plan; branches are protected: " +
+				"origin/fix-version (fix-version)"))
+		})
+	})
+})
@@ -0,0 +1,91 @@
+package clip
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PorcelainVersion is the only porcelain format version, the format of version 1 will not
+// change between releases
+const PorcelainVersion = "v1"
+
+// porcelainLine formats 'branch' as a single line of the porcelain v1 format
+func porcelainLine(branch, trunk *BranchDetail) string {
+	fields := []string{
+		branch.Name,
+		branch.Sha,
+		porcelainUpstream(branch.Tracked),
+		strconv.Itoa(branch.Trunk.Ahead),
+		strconv.Itoa(branch.Trunk.Behind),
+	}
+
+	var remotes []string
+	for _, remote := range branch.Remotes {
+		if remote != nil {
+			remotes = append(remotes, porcelainCount(remote.Ref, branch.RemoteCounts[remote.Ref]))
+		}
+	}
+	fields = append(fields, porcelainList(remotes, " "))
+
+	var flags []string
+	if branch == trunk {
+		flags = append(flags, "trunk")
+	}
+	if branch.Merged != "" {
+		flags = append(flags, "merged="+branch.Merged)
+	}
+	if branch.Err != nil {
+		flags = append(flags, "error")
+	}
+	fields = append(fields, porcelainList(flags, ","))
+
+	var bases []string
+	for _, base := range branch.Bases {
+		bases = append(bases, porcelainCount(base.Base, base.AheadBehind))
+	}
+	fields = append(fields, porcelainList(bases, " "))
+
+	return strings.Join(fields, "\t") + "\n"
+}
+
+// WritePorcelain writes 'branch' as a single line of the porcelain v1 format, 'trunk' is the
+// trunk of the report the branch is from. Fields are separated by tabs, empty fields are
+// written as `-`
+//
+//	<name> <sha> <upstream> <ahead> <behind> <remotes> <flags> <bases>
+//
+// ahead and behind are relative to the trunk. remotes is a space separated list of
+// `<ref>:<ahead>:<behind>`. flags is a comma separated list of `trunk`, `merged=<method>`
+// and `error`. bases is a space separated list of `<name>:<ahead>:<behind>`.
+func WritePorcelain(writer io.Writer, branch, trunk *BranchDetail) error {
+	_, err := io.WriteString(writer, porcelainLine(branch, trunk))
+	return err
+}
+
+// porcelainUpstream returns the upstream as `<remote>/<branch>`, or the branch name if the
+// upstream is a local branch
+func porcelainUpstream(tracked *TrackedBranch) string {
+	if tracked == nil {
+		return "-"
+	}
+	name, err := GetRemoteBranchName(tracked.Merge)
+	if err != nil {
+		return "-"
+	}
+	if tracked.Remote == "." {
+		return name
+	}
+	return tracked.Remote + "/" + name
+}
+
+func porcelainCount(name string, count AheadBehind) string {
+	return name + ":" + strconv.Itoa(count.Ahead) + ":" + strconv.Itoa(count.Behind)
+}
+
+func porcelainList(items []string, sep string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return strings.Join(items, sep)
+}
@@ -0,0 +1,41 @@
+package clip_test
+
+import (
+	"bytes"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var _ = Describe("WritePorcelain()", func() {
+	It("Should write one tab separated line for the branch", func() {
+		trunk := &clip.BranchDetail{
+			Name:         "master",
+			Sha:          shaMaster,
+			Tracked:      &clip.TrackedBranch{Remote: "origin", Merge: "refs/heads/master"},
+			Remotes:      []*clip.Branch{{Ref: "remotes/origin/master"}, nil},
+			RemoteCounts: map[string]clip.AheadBehind{"remotes/origin/master": {Behind: 2}},
+		}
+		fix := &clip.BranchDetail{
+			Name:    "fix-me-local",
+			Sha:     shaFix,
+			Tracked: &clip.TrackedBranch{Remote: ".", Merge: "refs/heads/master"},
+			Trunk:   clip.AheadBehind{Ahead: 3, Behind: 1},
+			Merged:  clip.MergedPatchID,
+			Bases: []clip.BaseCount{
+				{Base: "origin/master", AheadBehind: clip.AheadBehind{Ahead: 3, Behind: 3}},
+				{Base: "release/2.4"},
+			},
+			Err: errors.New("bad object"),
+		}
+		var buf bytes.Buffer
+		Expect(clip.WritePorcelain(&buf, trunk, trunk)).To(Succeed())
+		Expect(clip.WritePorcelain(&buf, fix, trunk)).To(Succeed())
+		Expect(buf.String()).To(Equal(
+			"master\t" + shaMaster + "\torigin/master\t0\t0\tremotes/origin/master:0:2\ttrunk\t-\n" +
+				"fix-me-local\t" + shaFix + "\tmaster\t3\t1\t-\tmerged=patch-id,error\t" +
+				"origin/master:3:3 release/2.4:0:0\n"))
+	})
+})
@@ -0,0 +1,226 @@
+package clip
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBatchSize is the number of branches deleted by a single push
+const DefaultBatchSize = 50
+
+// PushResult is the outcome of pushing a single ref as reported by `git push --porcelain`
+type PushResult struct {
+	// Ref is the remote ref that was updated
+	Ref string
+	// Flag is the status flag, '!' means the ref was rejected
+	Flag string
+	// Summary such as `[deleted]` or `[remote rejected]`
+	Summary string
+	// Reason is given for rejected refs
+	Reason string
+	// Old is the sha a deleted ref pointed to on the remote, the remote only accepts a
+	// leased deletion if the ref still pointed to the sha of the lease
+	Old string
+}
+
+func (p PushResult) OK() bool {
+	return p.Flag != "!"
+}
+
+// Lease is a remote branch to delete only if it still points to Sha on the remote
+type Lease struct {
+	Branch string
+	Sha    string
+}
+
+func (b *ExecBackend) PushDelete(result *[]PushResult, remote string, leases []Lease, atomic bool) error {
+	args := []string{"push", "--porcelain"}
+	if atomic {
+		args = append(args, "--atomic")
+	}
+	// A branch that moved since it was looked at is rejected as `stale info`
+	for _, lease := range leases {
+		args = append(args, "--force-with-lease=refs/heads/"+lease.Branch+":"+lease.Sha)
+	}
+	args = append(args, remote)
+	for _, lease := range leases {
+		args = append(args, ":refs/heads/"+lease.Branch)
+	}
+
+	var output string
+	err := b.git(&output, args...)
+	// `git push` exits with 1 if any ref was rejected, the porcelain output says which
+	start := len(*result)
+	if parseErr := ParsePushPorcelain(result, output); parseErr != nil {
+		return parseErr
+	}
+	if err != nil && len(*result) == start {
+		return errors.Wrap(err, "PushDelete()")
+	}
+
+	// The porcelain output doesn't include the sha of deleted refs
+	for idx := start; idx < len(*result); idx++ {
+		push := &(*result)[idx]
+		for _, lease := range leases {
+			if push.OK() && push.Ref == "refs/heads/"+lease.Branch {
+				push.Old = lease.Sha
+			}
+		}
+	}
+	return nil
+}
+
+// ParsePushPorcelain parses the output of `git push --porcelain`, each ref is reported as
+// `<flag> TAB <from>:<to> TAB <summary> (<reason>)`
+func ParsePushPorcelain(result *[]PushResult, input string) error {
+	for _, line := range strings.Split(input, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			// `To <url>` and `Done` lines
+			continue
+		}
+		refs := strings.SplitN(fields[1], ":", 2)
+		if len(refs) != 2 {
+			return errors.Errorf("unexpected 'git push' output '%s'", line)
+		}
+		push := PushResult{Flag: fields[0], Ref: refs[1], Summary: fields[2]}
+		if idx := strings.Index(push.Summary, " ("); idx != -1 && strings.HasSuffix(push.Summary, ")") {
+			push.Reason = push.Summary[idx+2 : len(push.Summary)-1]
+			push.Summary = push.Summary[:idx]
+		}
+		*result = append(*result, push)
+	}
+	return nil
+}
+
+// ClipOpts configures Repository.ClipRemoteBranches()
+type ClipOpts struct {
+	// BatchSize is the number of branches deleted per push, defaults to DefaultBatchSize
+	BatchSize int
+	// NoAtomic deletes branches in a batch independently of each other. By default a batch
+	// is deleted atomically, either every branch in the batch is deleted or none are.
+	NoAtomic bool
+}
+
+// ClipResult is the outcome of deleting a single remote branch
+type ClipResult struct {
+	Deletion Deletion
+	// Entry is the journal entry recording the deletion
+	Entry JournalEntry
+	// Err is set if the branch was not deleted or the deletion could not be recorded
+	Err error
+	// AnchorErr is set if the branch was deleted and recorded but its sha could not be
+	// anchored, such as when the commit is not in the local repository. The deletion can
+	// still be undone as long as the commits are not garbage collected.
+	AnchorErr error
+}
+
+// ClipRemoteBranches deletes the remote branch of each of 'deletions' with as few pushes as
+// possible, only if the branch still points to the sha of the deletion. Each deleted branch
+// is recorded in the journal and its sha kept by an anchor ref, see JournalAnchor(), so the
+// deletion can be undone with RestoreRemoteBranch(). Failures are reported per branch in
+// the results.
+func (r *Repository) ClipRemoteBranches(deletions []Deletion, opts ClipOpts) ([]ClipResult, error) {
+	journal, err := r.Journal()
+	if err != nil {
+		return nil, err
+	}
+	size := opts.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	// Each push is to a single remote
+	var remotes []string
+	byRemote := map[string][]Deletion{}
+	for _, deletion := range deletions {
+		if _, ok := byRemote[deletion.Remote]; !ok {
+			remotes = append(remotes, deletion.Remote)
+		}
+		byRemote[deletion.Remote] = append(byRemote[deletion.Remote], deletion)
+	}
+
+	var results []ClipResult
+	for _, remote := range remotes {
+		pending := byRemote[remote]
+		for len(pending) != 0 {
+			batch := pending
+			if len(batch) > size {
+				batch = batch[:size]
+			}
+			pending = pending[len(batch):]
+
+			pushed, err := r.pushDelete(remote, batch, !opts.NoAtomic)
+			for _, deletion := range batch {
+				result := ClipResult{Deletion: deletion, Err: err}
+				if err == nil {
+					r.recordDeletion(journal, pushed, &result)
+				}
+				results = append(results, result)
+			}
+		}
+	}
+	return results, nil
+}
+
+// pushDelete deletes 'batch' from 'remote' falling back to a non atomic push if the remote
+// doesn't support atomic pushes
+func (r *Repository) pushDelete(remote string, batch []Deletion, atomic bool) ([]PushResult, error) {
+	var leases []Lease
+	for _, deletion := range batch {
+		leases = append(leases, Lease{Branch: deletion.Branch, Sha: deletion.Sha})
+	}
+
+	var pushed []PushResult
+	err := r.Backend.PushDelete(&pushed, remote, leases, atomic)
+	if err != nil && atomic && strings.Contains(err.Error(), "does not support --atomic") {
+		pushed = nil
+		err = r.Backend.PushDelete(&pushed, remote, leases, false)
+	}
+	return pushed, err
+}
+
+// recordDeletion records the deletion of 'result' in the journal if the push of its branch
+// succeeded, the sha recorded is the one the remote deleted
+func (r *Repository) recordDeletion(journal *Journal, pushed []PushResult, result *ClipResult) {
+	push, err := pushResult(pushed, result.Deletion.Branch)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	sha := push.Old
+	if sha == "" {
+		sha = result.Deletion.Sha
+	}
+	result.Entry, result.Err = journal.Record(JournalEntry{
+		Action: JournalDelete,
+		Remote: result.Deletion.Remote,
+		Branch: result.Deletion.Branch,
+		Sha:    sha,
+	})
+	if result.Err != nil {
+		return
+	}
+	// Keep the commits of the branch from being garbage collected until it's restored
+	if err := r.Backend.UpdateRef(JournalAnchor(result.Entry.ID), sha); err != nil {
+		result.AnchorErr = errors.Wrapf(err, "while anchoring journal entry %d", result.Entry.ID)
+	}
+}
+
+// pushResult returns the push of 'branch' or an error if it was rejected or not reported
+func pushResult(pushed []PushResult, branch string) (PushResult, error) {
+	for _, push := range pushed {
+		if push.Ref != "refs/heads/"+branch {
+			continue
+		}
+		if push.OK() {
+			return push, nil
+		}
+		if push.Reason != "" {
+			return push, errors.Errorf("%s (%s)", push.Summary, push.Reason)
+		}
+		return push, errors.New(push.Summary)
+	}
+	return PushResult{}, errors.Errorf("push did not report '%s'", branch)
+}
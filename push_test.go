@@ -0,0 +1,133 @@
+package clip_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var pushPorcelain = `To /tmp/remote.git
+-	:refs/heads/stale	[deleted]
+!	:refs/heads/keep	[remote rejected] (hook declined)
+!	:refs/heads/other	[remote rejected] (atomic push failure)
+Done
+`
+
+var _ = Describe("ParsePushPorcelain()", func() {
+	It("Should parse the result of each ref", func() {
+		var result []clip.PushResult
+		Expect(clip.ParsePushPorcelain(&result, pushPorcelain)).To(Succeed())
+		Expect(result).To(Equal([]clip.PushResult{
+			{Ref: "refs/heads/stale", Flag: "-", Summary: "[deleted]"},
+			{Ref: "refs/heads/keep", Flag: "!", Summary: "[remote rejected]", Reason: "hook declined"},
+			{Ref: "refs/heads/other", Flag: "!", Summary: "[remote rejected]", Reason: "atomic push failure"},
+		}))
+		Expect(result[0].OK()).To(Equal(true))
+		Expect(result[1].OK()).To(Equal(false))
+	})
+})
+
+var _ = Describe("ClipRemoteBranches()", func() {
+	var backend *fakeBackend
+	var repo *clip.Repository
+	var root string
+
+	deletions := []clip.Deletion{
+		{Remote: "origin", Branch: "one", Sha: shaFix},
+		{Remote: "origin", Branch: "two", Sha: shaFix},
+		{Remote: "origin", Branch: "three", Sha: shaFix},
+		{Remote: "upstream", Branch: "four", Sha: shaMaster},
+	}
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-push")
+		Expect(err).To(BeNil())
+		backend = &fakeBackend{config: gitConfigNull, refs: gitShowRef, gitDir: root}
+		repo = clip.NewRepository(backend)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Should push each remote in batches", func() {
+		results, err := repo.ClipRemoteBranches(deletions, clip.ClipOpts{BatchSize: 2})
+		Expect(err).To(BeNil())
+		Expect(backend.pushes).To(Equal(3))
+		Expect(backend.deleted).To(Equal([]string{"origin/one", "origin/two", "origin/three", "upstream/four"}))
+		for idx, result := range results {
+			Expect(result.Err).To(BeNil())
+			Expect(result.Entry.ID).To(Equal(idx + 1))
+		}
+	})
+
+	It("Should report the failure of each branch in an atomic batch", func() {
+		backend.reject = map[string]string{"two": "hook declined"}
+		results, err := repo.ClipRemoteBranches(deletions, clip.ClipOpts{BatchSize: 2})
+		Expect(err).To(BeNil())
+		Expect(results[0].Err).To(MatchError("[remote rejected] (atomic push failure)"))
+		Expect(results[1].Err).To(MatchError("[remote rejected] (hook declined)"))
+		Expect(results[2].Err).To(BeNil())
+		Expect(results[3].Err).To(BeNil())
+		Expect(backend.deleted).To(Equal([]string{"origin/three", "upstream/four"}))
+
+		// Only deleted branches are in the journal
+		entries, err := clip.OpenJournal(root).Entries()
+		Expect(err).To(BeNil())
+		Expect(len(entries)).To(Equal(2))
+	})
+
+	It("Should delete the other branches of a batch when not atomic", func() {
+		backend.reject = map[string]string{"two": "hook declined"}
+		results, err := repo.ClipRemoteBranches(deletions, clip.ClipOpts{NoAtomic: true})
+		Expect(err).To(BeNil())
+		Expect(backend.pushes).To(Equal(2))
+		Expect(results[1].Err).To(MatchError("[remote rejected] (hook declined)"))
+		Expect(backend.deleted).To(Equal([]string{"origin/one", "origin/three", "upstream/four"}))
+	})
+
+	It("Should report rejected refs from a real remote", func() {
+		remote := filepath.Join(root, "remote.git")
+		work := filepath.Join(root, "work")
+		Expect(os.MkdirAll(work, 0755)).To(Succeed())
+		git(root, "init", "-q", "--bare", remote)
+
+		git(work, "init", "-q", "-b", "main")
+		git(work, "commit", "-q", "--allow-empty", "-m", "init")
+		git(work, "remote", "add", "origin", remote)
+		git(work, "push", "-q", "origin", "main:keep", "main:stale", "main:moved")
+		sha := strings.TrimSpace(git(work, "rev-parse", "main"))
+		git(work, "commit", "-q", "--allow-empty", "-m", "next")
+		git(work, "push", "-q", "origin", "main:moved")
+		// The remote refuses to update 'keep'
+		writeFile(filepath.Join(remote, "hooks", "update"),
+			"#!/bin/sh\ntest \"$1\" != refs/heads/keep || exit 1\n")
+		Expect(os.Chmod(filepath.Join(remote, "hooks", "update"), 0755)).To(Succeed())
+
+		var result []clip.PushResult
+		exec := clip.NewExecBackend(work)
+		Expect(exec.PushDelete(&result, "origin", []clip.Lease{
+			{Branch: "keep", Sha: sha},
+			{Branch: "stale", Sha: sha},
+			{Branch: "moved", Sha: sha},
+		}, false)).To(Succeed())
+		Expect(len(result)).To(Equal(3))
+		// git reports refs in its own order
+		pushed := map[string]clip.PushResult{}
+		for _, push := range result {
+			pushed[push.Ref] = push
+		}
+		Expect(pushed["refs/heads/keep"].OK()).To(Equal(false))
+		Expect(pushed["refs/heads/keep"].Reason).To(Equal("hook declined"))
+		Expect(pushed["refs/heads/stale"].OK()).To(Equal(true))
+		// 'moved' no longer points to the leased sha
+		Expect(pushed["refs/heads/moved"].OK()).To(Equal(false))
+		Expect(pushed["refs/heads/moved"].Reason).To(Equal("stale info"))
+	})
+})
@@ -0,0 +1,378 @@
+package clip
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// NativeBackend implements GitBackend by reading the repository files directly. Any
+// operations not implemented natively are passed on to the embedded ExecBackend.
+type NativeBackend struct {
+	*ExecBackend
+	// GitDir is the git directory of the current worktree, which holds HEAD
+	GitDir string
+	// CommonDir is the git directory shared by all worktrees, which holds refs and objects
+	CommonDir string
+
+	objects     *ObjectStore
+	objectsErr  error
+	objectsOnce sync.Once
+}
+
+// NewNativeBackend locates the git directory for the repository containing 'dir'. If 'dir'
+// is empty the current working directory is used.
+func NewNativeBackend(dir string) (*NativeBackend, error) {
+	gitDir, commonDir, err := FindGitDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &NativeBackend{
+		ExecBackend: NewExecBackend(dir),
+		GitDir:      gitDir,
+		CommonDir:   commonDir,
+	}, nil
+}
+
+// NewNativeBackendAt returns a NativeBackend for the repository at 'dir' found by a search
+// such as FindRepositories(). $GIT_DIR and the other variables which point git at a
+// specific repository are ignored, both when finding the git dir and when running git.
+func NewNativeBackendAt(dir string) (*NativeBackend, error) {
+	gitDir, commonDir, err := findGitDir(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	backend := NewExecBackend(dir)
+	backend.Env = withoutRepositoryEnv(os.Environ())
+	return &NativeBackend{
+		ExecBackend: backend,
+		GitDir:      gitDir,
+		CommonDir:   commonDir,
+	}, nil
+}
+
+// repositoryEnv are the variables git unsets before running in another repository, such as
+// a submodule, as they only apply to the current repository
+var repositoryEnv = map[string]bool{
+	"GIT_DIR":                          true,
+	"GIT_COMMON_DIR":                   true,
+	"GIT_WORK_TREE":                    true,
+	"GIT_IMPLICIT_WORK_TREE":           true,
+	"GIT_INDEX_FILE":                   true,
+	"GIT_OBJECT_DIRECTORY":             true,
+	"GIT_ALTERNATE_OBJECT_DIRECTORIES": true,
+	"GIT_GRAFT_FILE":                   true,
+	"GIT_SHALLOW_FILE":                 true,
+	"GIT_NAMESPACE":                    true,
+	"GIT_PREFIX":                       true,
+	"GIT_NO_REPLACE_OBJECTS":           true,
+	"GIT_REPLACE_REF_BASE":             true,
+}
+
+// withoutRepositoryEnv returns 'env' without the variables in repositoryEnv
+func withoutRepositoryEnv(env []string) []string {
+	var result []string
+	for _, entry := range env {
+		if !repositoryEnv[strings.SplitN(entry, "=", 2)[0]] {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func (b *NativeBackend) GitCommonDir() (string, error) {
+	return b.CommonDir, nil
+}
+
+// FindGitDir returns the git directory and common directory for the repository containing
+// 'dir'. It honours $GIT_DIR and $GIT_COMMON_DIR, `gitdir:` files used by worktrees and
+// submodules and the `commondir` file of linked worktrees.
+func FindGitDir(dir string) (gitDir, commonDir string, err error) {
+	return findGitDir(dir, true)
+}
+
+// findGitDir is FindGitDir() which only honours $GIT_DIR and $GIT_COMMON_DIR if 'useEnv'
+func findGitDir(dir string, useEnv bool) (gitDir, commonDir string, err error) {
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return "", "", errors.Wrap(err, "FindGitDir()")
+		}
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", "", errors.Wrap(err, "FindGitDir()")
+	}
+
+	if env := os.Getenv("GIT_DIR"); env != "" && useEnv {
+		gitDir = env
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(dir, gitDir)
+		}
+	} else {
+		if gitDir, err = discoverGitDir(dir); err != nil {
+			return "", "", err
+		}
+	}
+
+	commonDir = gitDir
+	if env := os.Getenv("GIT_COMMON_DIR"); env != "" && useEnv {
+		commonDir = env
+	} else if content, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(content))
+	}
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	return filepath.Clean(gitDir), filepath.Clean(commonDir), nil
+}
+
+// discoverGitDir walks up from 'dir' looking for a `.git` directory or `gitdir:` file
+func discoverGitDir(dir string) (string, error) {
+	for current := dir; ; {
+		dotGit := filepath.Join(current, ".git")
+		if stat, err := os.Stat(dotGit); err == nil {
+			if stat.IsDir() {
+				return dotGit, nil
+			}
+			return readGitDirFile(dotGit)
+		}
+		// Could be a bare repository
+		if isGitDir(current) {
+			return current, nil
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return "", errors.Errorf("not a git repository (or any of the parent directories): %s", dir)
+		}
+		current = parent
+	}
+}
+
+// readGitDirFile returns the path referenced by a `gitdir: <path>` file
+func readGitDirFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "readGitDirFile()")
+	}
+	line := strings.TrimSpace(string(content))
+	if !strings.HasPrefix(line, "gitdir:") {
+		return "", errors.Errorf("invalid gitdir file '%s'", path)
+	}
+	gitDir := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	return gitDir, nil
+}
+
+func isGitDir(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// isReftable returns true if the repository uses the reftable format which has no loose or
+// packed refs to read
+func (b *NativeBackend) isReftable() bool {
+	_, err := os.Stat(filepath.Join(b.CommonDir, "reftable"))
+	return err == nil
+}
+
+func (b *NativeBackend) ListRefs(result BranchReferenceMap) error {
+	if b.isReftable() {
+		return b.ExecBackend.ListRefs(result)
+	}
+
+	refs := map[string]string{}
+	if err := b.ReadRefs(refs); err != nil {
+		return err
+	}
+	for name, sha := range refs {
+		addBranchRef(result, strings.TrimPrefix(name, "refs/"), sha)
+	}
+	return nil
+}
+
+// ReadRefs adds every ref in the repository to 'result' as a map of the full ref name to
+// the sha it points to. Symbolic refs are resolved to the sha of their target.
+func (b *NativeBackend) ReadRefs(result map[string]string) error {
+	symbolic := map[string]string{}
+
+	if err := readPackedRefs(result, filepath.Join(b.CommonDir, "packed-refs")); err != nil {
+		return err
+	}
+	// Loose refs take precedence over packed refs
+	dirs := []string{b.CommonDir}
+	if b.GitDir != b.CommonDir {
+		// Per worktree refs such as refs/bisect live in the worktree git dir
+		dirs = append(dirs, b.GitDir)
+	}
+	for _, dir := range dirs {
+		if err := readLooseRefs(result, symbolic, dir); err != nil {
+			return err
+		}
+	}
+
+	for name := range symbolic {
+		if sha, err := resolveSymbolic(name, result, symbolic); err == nil {
+			result[name] = sha
+		}
+	}
+	return nil
+}
+
+// ResolveRef returns the sha 'name' points to, 'name' can be HEAD or a full ref name
+func (b *NativeBackend) ResolveRef(name string) (string, error) {
+	refs := map[string]string{}
+	if err := b.ReadRefs(refs); err != nil {
+		return "", err
+	}
+	target, err := b.ReadSymbolicRef(name)
+	if err != nil {
+		return "", err
+	}
+	if target == "" {
+		// Not a symbolic ref; HEAD is detached or 'name' is a regular ref
+		if sha, err := readRefFile(b.refPath(name)); err == nil && isSha(sha) {
+			return sha, nil
+		}
+		target = name
+	}
+	sha, ok := refs[target]
+	if !ok {
+		return "", errors.Errorf("ref '%s' does not exist", target)
+	}
+	return sha, nil
+}
+
+// ReadSymbolicRef returns the target of the symbolic ref 'name' or an empty string if 'name'
+// is not a symbolic ref
+func (b *NativeBackend) ReadSymbolicRef(name string) (string, error) {
+	content, err := readRefFile(b.refPath(name))
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return "", nil
+		}
+		return "", err
+	}
+	if strings.HasPrefix(content, "ref:") {
+		return strings.TrimSpace(strings.TrimPrefix(content, "ref:")), nil
+	}
+	return "", nil
+}
+
+// refPath returns the file path of a loose ref, pseudo refs like HEAD and per worktree refs
+// live in the worktree git dir while everything else is in the common dir
+func (b *NativeBackend) refPath(name string) string {
+	if !strings.HasPrefix(name, "refs/") || strings.HasPrefix(name, "refs/bisect/") ||
+		strings.HasPrefix(name, "refs/worktree/") || strings.HasPrefix(name, "refs/rewritten/") {
+		return filepath.Join(b.GitDir, filepath.FromSlash(name))
+	}
+	return filepath.Join(b.CommonDir, filepath.FromSlash(name))
+}
+
+// readPackedRefs parses a `packed-refs` file, peeled `^` lines which record the commit an
+// annotated tag points to are skipped
+func readPackedRefs(result map[string]string, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "readPackedRefs()")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 || !isSha(parts[0]) {
+			continue
+		}
+		result[parts[1]] = parts[0]
+	}
+	return errors.Wrap(scanner.Err(), "readPackedRefs()")
+}
+
+// readLooseRefs walks the `refs` directory of 'gitDir' adding sha refs to 'result' and
+// symbolic refs to 'symbolic'
+func readLooseRefs(result, symbolic map[string]string, gitDir string) error {
+	root := filepath.Join(gitDir, "refs")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(gitDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		content, err := readRefFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(content, "ref:") {
+			symbolic[name] = strings.TrimSpace(strings.TrimPrefix(content, "ref:"))
+			return nil
+		}
+		if isSha(content) {
+			result[name] = content
+		}
+		return nil
+	})
+	return errors.Wrap(err, "readLooseRefs()")
+}
+
+// resolveSymbolic follows a chain of symbolic refs until it finds a sha
+func resolveSymbolic(name string, refs, symbolic map[string]string) (string, error) {
+	// Git limits the depth of symbolic refs to 5
+	for depth := 0; depth < 5; depth++ {
+		target, ok := symbolic[name]
+		if !ok {
+			if sha, ok := refs[name]; ok {
+				return sha, nil
+			}
+			return "", errors.Errorf("symbolic ref '%s' points to missing ref", name)
+		}
+		name = target
+	}
+	return "", errors.Errorf("symbolic ref '%s' nested too deeply", name)
+}
+
+func readRefFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err, "readRefFile()")
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func isSha(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
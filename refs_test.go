@@ -0,0 +1,146 @@
+package clip_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+const (
+	shaMaster = "2dc90a39c09e52045a483fc8b58e45da386fb149"
+	shaFix    = "1a55f87bb9542848d1b19c2bde3f1552426a6b99"
+	shaLoose  = "5f813e2f5a9cd6335e36797dd3428a7632d52102"
+	shaTag    = "01dbc5ce8be93f8437e4ae91833a99e0666b5e5e"
+)
+
+var packedRefs = `# pack-refs with: peeled fully-peeled sorted
+` + shaMaster + ` refs/heads/master
+` + shaFix + ` refs/heads/fix-me-local
+` + shaMaster + ` refs/remotes/origin/master
+` + shaFix + ` refs/remotes/upstream/fix-version
+` + shaTag + ` refs/tags/v1.0.0
+^` + shaMaster + `
+`
+
+func writeFile(path, content string) {
+	Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+}
+
+// git runs a git command in 'dir' failing the test if it errors
+func git(dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+dir,
+		"GIT_AUTHOR_NAME=Clip", "GIT_AUTHOR_EMAIL=clip@example.com",
+		"GIT_COMMITTER_NAME=Clip", "GIT_COMMITTER_EMAIL=clip@example.com")
+	output, err := cmd.CombinedOutput()
+	Expect(err).To(BeNil(), string(output))
+	return string(output)
+}
+
+// newGitDir creates a fake git directory with loose and packed refs
+func newGitDir(root string) string {
+	gitDir := filepath.Join(root, ".git")
+	writeFile(filepath.Join(gitDir, "HEAD"), "ref: refs/heads/master\n")
+	writeFile(filepath.Join(gitDir, "packed-refs"), packedRefs)
+	Expect(os.MkdirAll(filepath.Join(gitDir, "objects"), 0755)).To(Succeed())
+	// Loose refs override packed refs
+	writeFile(filepath.Join(gitDir, "refs/heads/master"), shaLoose+"\n")
+	writeFile(filepath.Join(gitDir, "refs/heads/feature/one"), shaLoose+"\n")
+	writeFile(filepath.Join(gitDir, "refs/remotes/origin/HEAD"), "ref: refs/remotes/origin/master\n")
+	writeFile(filepath.Join(gitDir, "refs/remotes/origin/feature/one.lock"), shaFix+"\n")
+	return gitDir
+}
+
+var _ = Describe("NativeBackend", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-refs")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	Describe("ListRefs()", func() {
+		It("Should read loose and packed refs", func() {
+			newGitDir(root)
+			backend, err := clip.NewNativeBackend(root)
+			Expect(err).To(BeNil())
+
+			refs := clip.BranchReferenceMap{}
+			Expect(backend.ListRefs(refs)).To(Succeed())
+
+			Expect(len(refs["local"])).To(Equal(3))
+			Expect(refs["local"]["master"].Sha).To(Equal(shaLoose))
+			Expect(refs["local"]["master"].Ref).To(Equal("heads/master"))
+			Expect(refs["local"]["feature/one"].Sha).To(Equal(shaLoose))
+			Expect(refs["local"]["fix-me-local"].Sha).To(Equal(shaFix))
+
+			Expect(len(refs["origin"])).To(Equal(2))
+			Expect(refs["origin"]["HEAD"].Sha).To(Equal(shaMaster))
+			Expect(refs["origin"]["HEAD"].Ref).To(Equal("remotes/origin/HEAD"))
+			Expect(refs["upstream"]["fix-version"].Sha).To(Equal(shaFix))
+		})
+
+		It("Should read refs from the common dir of a linked worktree", func() {
+			gitDir := newGitDir(filepath.Join(root, "main"))
+			worktreeDir := filepath.Join(gitDir, "worktrees", "wt")
+			writeFile(filepath.Join(worktreeDir, "HEAD"), "ref: refs/heads/fix-me-local\n")
+			writeFile(filepath.Join(worktreeDir, "commondir"), "../..\n")
+			writeFile(filepath.Join(root, "wt", ".git"), "gitdir: "+worktreeDir+"\n")
+
+			backend, err := clip.NewNativeBackend(filepath.Join(root, "wt"))
+			Expect(err).To(BeNil())
+			Expect(backend.GitDir).To(Equal(worktreeDir))
+			Expect(backend.CommonDir).To(Equal(gitDir))
+
+			refs := clip.BranchReferenceMap{}
+			Expect(backend.ListRefs(refs)).To(Succeed())
+			Expect(len(refs["local"])).To(Equal(3))
+
+			sha, err := backend.ResolveRef("HEAD")
+			Expect(err).To(BeNil())
+			Expect(sha).To(Equal(shaFix))
+		})
+
+		It("Should honour $GIT_DIR", func() {
+			gitDir := newGitDir(filepath.Join(root, "elsewhere"))
+			os.Setenv("GIT_DIR", gitDir)
+			defer os.Unsetenv("GIT_DIR")
+
+			backend, err := clip.NewNativeBackend(root)
+			Expect(err).To(BeNil())
+			Expect(backend.GitDir).To(Equal(gitDir))
+		})
+
+		It("Should match the output of `git show-ref`", func() {
+			git(root, "init", "-q", "-b", "master")
+			git(root, "commit", "-q", "--allow-empty", "-m", "first")
+			git(root, "branch", "packed")
+			git(root, "tag", "-a", "-m", "annotated", "v1.0.0")
+			git(root, "pack-refs", "--all")
+			git(root, "commit", "-q", "--allow-empty", "-m", "second")
+			git(root, "update-ref", "refs/remotes/origin/master", "HEAD")
+			git(root, "symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/master")
+
+			native, err := clip.NewNativeBackend(root)
+			Expect(err).To(BeNil())
+			nativeRefs := clip.BranchReferenceMap{}
+			Expect(native.ListRefs(nativeRefs)).To(Succeed())
+
+			execRefs := clip.BranchReferenceMap{}
+			Expect(clip.NewExecBackend(root).ListRefs(execRefs)).To(Succeed())
+			Expect(nativeRefs).To(Equal(execRefs))
+		})
+	})
+})
@@ -0,0 +1,65 @@
+package clip
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Stash is an entry of `git stash list`
+type Stash struct {
+	// Ref names the entry like `stash@{0}`
+	Ref string
+	Sha string
+	// Branch is the branch the changes were stashed on or empty if HEAD was detached
+	Branch  string
+	Message string
+}
+
+// stashSubject matches the subjects `git stash` gives entries, `WIP on <branch>: <commit>`
+// or `On <branch>: <message>` if a message was given
+var stashSubject = regexp.MustCompile(`^(?:WIP on|On) (.+?): (.*)$`)
+
+// ParseStashList parses the output of `git stash list --format=%gd%x09%H%x09%gs`
+func ParseStashList(result *[]Stash, output string) error {
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			return errors.Errorf("invalid stash entry '%s'", line)
+		}
+		stash := Stash{Ref: fields[0], Sha: fields[1], Message: fields[2]}
+		if match := stashSubject.FindStringSubmatch(fields[2]); match != nil {
+			stash.Message = match[2]
+			if match[1] != "(no branch)" {
+				stash.Branch = match[1]
+			}
+		}
+		*result = append(*result, stash)
+	}
+	return nil
+}
+
+// ListStashes returns the stash entries newest first, bare repositories have none
+func (r *Repository) ListStashes() ([]Stash, error) {
+	var stashes []Stash
+	workTree, err := r.Backend.WorkTree()
+	if err != nil || workTree == "" {
+		return nil, err
+	}
+	if err := r.Backend.ListStashes(&stashes); err != nil {
+		return nil, err
+	}
+	return stashes, nil
+}
+
+func (b *ExecBackend) ListStashes(result *[]Stash) error {
+	var output string
+	if err := b.git(&output, "stash", "list", "--format=%gd%x09%H%x09%gs"); err != nil {
+		return errors.Wrap(err, "ListStashes()")
+	}
+	return ParseStashList(result, output)
+}
@@ -0,0 +1,51 @@
+package clip_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var stashList = "stash@{0}\t" + shaFix + "\tOn feature/one: half done\n" +
+	"stash@{1}\t" + shaTag + "\tWIP on (no branch): " + shaTag[:7] + " Release\n" +
+	"stash@{2}\t" + shaMaster + "\tWIP on master: " + shaMaster[:7] + " Add a: colon\n"
+
+var _ = Describe("ParseStashList()", func() {
+	It("Should record the branch of each entry", func() {
+		var stashes []clip.Stash
+		Expect(clip.ParseStashList(&stashes, stashList)).To(Succeed())
+		Expect(stashes).To(Equal([]clip.Stash{
+			{Ref: "stash@{0}", Sha: shaFix, Branch: "feature/one", Message: "half done"},
+			{Ref: "stash@{1}", Sha: shaTag, Message: shaTag[:7] + " Release"},
+			{Ref: "stash@{2}", Sha: shaMaster, Branch: "master", Message: shaMaster[:7] + " Add a: colon"},
+		}))
+	})
+})
+
+var _ = Describe("ResolveHead()", func() {
+	It("Should list the tags of a detached HEAD", func() {
+		repo := clip.NewRepository(&fakeBackend{tags: map[string][]string{shaTag: {"v1.0.0"}}})
+		head, err := repo.ResolveHead([]*clip.Worktree{
+			{Path: "/src/other", Branch: "master", Head: shaMaster},
+			{Path: "/src/clip", Head: shaTag, Current: true},
+		})
+		Expect(err).To(BeNil())
+		Expect(head.Detached()).To(Equal(true))
+		Expect(head).To(Equal(&clip.Head{Sha: shaTag, Tags: []string{"v1.0.0"}}))
+	})
+	It("Should use the symbolic ref in a bare repository", func() {
+		repo := clip.NewRepository(&fakeBackend{symbolic: map[string]string{"HEAD": "refs/heads/master"}})
+		head, err := repo.ResolveHead(nil)
+		Expect(err).To(BeNil())
+		Expect(head).To(Equal(&clip.Head{Branch: "master"}))
+	})
+})
+
+var _ = Describe("ParseStatus()", func() {
+	It("Should count staged, unstaged and untracked files", func() {
+		Expect(clip.ParseStatus("M  staged.go\n M unstaged.go\nMM both.go\nR  old.go -> new.go\n" +
+			"UU conflict.go\n?? new.txt\n?? other.txt\n")).To(Equal(clip.StatusCounts{
+			Staged: 3, Unstaged: 3, Untracked: 2,
+		}))
+	})
+})
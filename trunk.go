@@ -0,0 +1,147 @@
+package clip
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Where the name of the trunk branch came from
+const (
+	TrunkFromOption        = "option"
+	TrunkFromConfig        = "clip.trunk"
+	TrunkFromRemoteHead    = "remote HEAD"
+	TrunkFromDefaultBranch = "init.defaultBranch"
+	TrunkFromDefaults      = "default"
+)
+
+// The branch names used as the trunk when nothing else names one
+var defaultTrunks = []string{"main", "master", "trunk"}
+
+// Trunk is the local branch every other branch is compared against
+type Trunk struct {
+	*Branch
+	// Source describes how the trunk was chosen, one of the TrunkFrom constants
+	Source string
+}
+
+// ResolveTrunk finds the local branch to use as the trunk. The first of these that names a
+// branch is used; 'name' which is usually given on the command line, the `clip.trunk`
+// config, the branch `refs/remotes/<remote>/HEAD` points to, `init.defaultBranch` and
+// finally whichever of main, master or trunk exists. An error is returned if more than one
+// candidate is found at the same step since picking one would be a guess.
+func (r *Repository) ResolveTrunk(name string, refs BranchReferenceMap) (*Trunk, error) {
+	local := refs["local"]
+
+	// An explicitly named trunk must exist
+	if name != "" {
+		return newTrunk(local, name, TrunkFromOption)
+	}
+
+	config := Config{}
+	if err := r.Backend.ListConfig(config, `^clip\.trunk$|^init\.defaultbranch$`); err != nil {
+		return nil, err
+	}
+	if name := config.Get("clip.trunk"); name != "" {
+		return newTrunk(local, name, TrunkFromConfig)
+	}
+
+	names, err := r.remoteHeads(refs)
+	if err != nil {
+		return nil, err
+	}
+	if trunk, err := pickTrunk(local, names, TrunkFromRemoteHead); trunk != nil || err != nil {
+		return trunk, err
+	}
+
+	if name := config.Get("init.defaultBranch"); name != "" {
+		if _, ok := local[name]; ok {
+			return newTrunk(local, name, TrunkFromDefaultBranch)
+		}
+	}
+
+	trunk, err := pickTrunk(local, defaultTrunks, TrunkFromDefaults)
+	if trunk == nil && err == nil {
+		return nil, errors.New("unable to find a trunk branch; name one with --trunk or " +
+			"'git config clip.trunk <branch>'")
+	}
+	return trunk, err
+}
+
+// remoteHeads returns the branch names the `HEAD` of each remote points to. If `origin`
+// has a HEAD only its branch is returned.
+func (r *Repository) remoteHeads(refs BranchReferenceMap) ([]string, error) {
+	var remotes []string
+	for remote, branches := range refs {
+		if _, ok := branches["HEAD"]; ok && remote != "local" {
+			remotes = append(remotes, remote)
+		}
+	}
+	sort.Strings(remotes)
+
+	var names []string
+	for _, remote := range remotes {
+		prefix := "refs/remotes/" + remote + "/"
+		target, err := r.Backend.SymbolicRef(prefix + "HEAD")
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(target, prefix) {
+			continue
+		}
+		if remote == "origin" {
+			return []string{strings.TrimPrefix(target, prefix)}, nil
+		}
+		names = append(names, strings.TrimPrefix(target, prefix))
+	}
+	return names, nil
+}
+
+// pickTrunk returns the trunk if exactly one of 'names' exists locally, nil if none do and
+// an error if the choice is ambiguous
+func pickTrunk(local BranchMap, names []string, source string) (*Trunk, error) {
+	var found []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		if _, ok := local[name]; ok && !seen[name] {
+			seen[name] = true
+			found = append(found, name)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+		return newTrunk(local, found[0], source)
+	}
+	return nil, errors.Errorf("ambiguous trunk branch; found '%s' from %s, choose one with "+
+		"--trunk or 'git config clip.trunk <branch>'", strings.Join(found, "', '"), source)
+}
+
+func newTrunk(local BranchMap, name, source string) (*Trunk, error) {
+	branch, ok := local[name]
+	if !ok {
+		return nil, errors.Errorf("trunk branch '%s' from %s does not exist", name, source)
+	}
+	return &Trunk{Branch: branch, Source: source}, nil
+}
+
+func (b *ExecBackend) SymbolicRef(name string) (string, error) {
+	var output string
+	if err := b.git(&output, "symbolic-ref", "-q", name); err != nil {
+		// `git symbolic-ref -q` exits with 1 if 'name' is not a symbolic ref
+		if isExitCode(err, 1) {
+			return "", nil
+		}
+		return "", errors.Wrap(err, "SymbolicRef()")
+	}
+	return strings.TrimSpace(output), nil
+}
+
+func (b *NativeBackend) SymbolicRef(name string) (string, error) {
+	if b.isReftable() {
+		return b.ExecBackend.SymbolicRef(name)
+	}
+	return b.ReadSymbolicRef(name)
+}
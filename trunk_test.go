@@ -0,0 +1,113 @@
+package clip_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var _ = Describe("ResolveTrunk()", func() {
+	var backend *fakeBackend
+	var repo *clip.Repository
+
+	resolve := func(name string) (*clip.Trunk, error) {
+		refs := clip.BranchReferenceMap{}
+		Expect(repo.ListBranchRefs(refs)).To(Succeed())
+		return repo.ResolveTrunk(name, refs)
+	}
+
+	BeforeEach(func() {
+		backend = &fakeBackend{config: gitConfigNull, refs: gitShowRef}
+		repo = clip.NewRepository(backend)
+	})
+
+	It("Should use the named trunk", func() {
+		trunk, err := resolve("fix-me-local")
+		Expect(err).To(BeNil())
+		Expect(trunk.Name).To(Equal("fix-me-local"))
+		Expect(trunk.Sha).To(Equal(shaFix))
+		Expect(trunk.Source).To(Equal(clip.TrunkFromOption))
+	})
+
+	It("Should error if the named trunk does not exist", func() {
+		_, err := resolve("develop")
+		Expect(err).To(MatchError("trunk branch 'develop' from option does not exist"))
+	})
+
+	It("Should prefer clip.trunk from config", func() {
+		backend.config += "clip.trunk\nre-fix-version\x00"
+		trunk, err := resolve("")
+		Expect(err).To(BeNil())
+		Expect(trunk.Name).To(Equal("re-fix-version"))
+		Expect(trunk.Source).To(Equal(clip.TrunkFromConfig))
+	})
+
+	It("Should use the branch the remote HEAD points to", func() {
+		backend.refs += shaFix + " refs/heads/release/2.4\n"
+		backend.symbolic = map[string]string{
+			"refs/remotes/origin/HEAD": "refs/remotes/origin/release/2.4",
+		}
+		trunk, err := resolve("")
+		Expect(err).To(BeNil())
+		Expect(trunk.Name).To(Equal("release/2.4"))
+		Expect(trunk.Source).To(Equal(clip.TrunkFromRemoteHead))
+	})
+
+	It("Should use init.defaultBranch", func() {
+		backend.config += "init.defaultbranch\nbase-and-flake-fix\x00"
+		trunk, err := resolve("")
+		Expect(err).To(BeNil())
+		Expect(trunk.Name).To(Equal("base-and-flake-fix"))
+		Expect(trunk.Source).To(Equal(clip.TrunkFromDefaultBranch))
+	})
+
+	It("Should fall back to main, master or trunk", func() {
+		trunk, err := resolve("")
+		Expect(err).To(BeNil())
+		Expect(trunk.Name).To(Equal("master"))
+		Expect(trunk.Source).To(Equal(clip.TrunkFromDefaults))
+	})
+
+	It("Should report ambiguous trunk branches", func() {
+		backend.refs += shaFix + " refs/heads/main\n"
+		_, err := resolve("")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("ambiguous trunk branch; found 'main', 'master'"))
+	})
+
+	It("Should error if no trunk is found", func() {
+		backend.refs = shaFix + " refs/heads/develop\n"
+		_, err := resolve("")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(ContainSubstring("unable to find a trunk branch"))
+	})
+
+	It("Should read the remote HEAD from the repository", func() {
+		root, err := ioutil.TempDir("", "clip-trunk")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(root)
+		newHistoryRepo(root)
+		git(root, "branch", "-q", "-m", "master", "develop")
+		git(root, "update-ref", "refs/remotes/origin/develop", "develop")
+		git(root, "symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/develop")
+
+		for _, backend := range []clip.GitBackend{clip.NewExecBackend(root), nativeBackend(root)} {
+			repo := clip.NewRepository(backend)
+			refs := clip.BranchReferenceMap{}
+			Expect(repo.ListBranchRefs(refs)).To(Succeed())
+			trunk, err := repo.ResolveTrunk("", refs)
+			Expect(err).To(BeNil())
+			Expect(trunk.Name).To(Equal("develop"))
+			Expect(trunk.Source).To(Equal(clip.TrunkFromRemoteHead))
+		}
+	})
+})
+
+func nativeBackend(root string) *clip.NativeBackend {
+	backend, err := clip.NewNativeBackend(root)
+	Expect(err).To(BeNil())
+	return backend
+}
@@ -0,0 +1,469 @@
+package clip
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoTerminal is returned by Select() when there is no terminal to draw on, callers should
+// fall back to asking with YesNo()
+var ErrNoTerminal = errors.New("not a terminal")
+
+// SelectItem is a branch offered by Select()
+type SelectItem struct {
+	Name string
+	// Counts is the commits ahead and behind the trunk, nil if unknown
+	Counts *AheadBehind
+	// Date of the last commit, zero if unknown
+	Date     time.Time
+	Author   string
+	Selected bool
+}
+
+// The orders the selector can sort items in, cycled with `s`
+var selectSorts = []string{"name", "age", "ahead", "author"}
+
+// Selector modes, which decide what a key press does
+const (
+	selectList = iota
+	selectFilter
+	selectPattern
+	selectConfirm
+)
+
+// Selector is the state of the multi-select list drawn by Select(). It's kept apart from
+// the terminal so it can be driven by tests.
+type Selector struct {
+	Title string
+	Items []SelectItem
+	// Now is the time the age of items is relative to
+	Now time.Time
+
+	mode    int
+	sort    int
+	filter  string
+	pattern string
+	message string
+	// cursor is the position in visible() and offset the first row drawn
+	cursor    int
+	offset    int
+	done      bool
+	cancelled bool
+}
+
+// NewSelector returns a selector listing 'items' in the order given
+func NewSelector(title string, items []SelectItem) *Selector {
+	return &Selector{Title: title, Items: items, Now: time.Now()}
+}
+
+// Done returns true once the selection was confirmed
+func (s *Selector) Done() bool {
+	return s.done
+}
+
+// Cancelled returns true if the user quit without confirming
+func (s *Selector) Cancelled() bool {
+	return s.cancelled
+}
+
+// Selected returns the selected items in the order they were given
+func (s *Selector) Selected() []SelectItem {
+	var selected []SelectItem
+	for _, item := range s.Items {
+		if item.Selected {
+			selected = append(selected, item)
+		}
+	}
+	return selected
+}
+
+// visible returns the index of each item matching the filter in the current sort order
+func (s *Selector) visible() []int {
+	var indexes []int
+	filter := strings.ToLower(s.filter)
+	for idx, item := range s.Items {
+		if strings.Contains(strings.ToLower(item.Name), filter) {
+			indexes = append(indexes, idx)
+		}
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool {
+		one, two := s.Items[indexes[i]], s.Items[indexes[j]]
+		switch selectSorts[s.sort] {
+		case "age":
+			// Oldest first since those are the likeliest to be deleted, unknown ages last
+			if one.Date.IsZero() != two.Date.IsZero() {
+				return two.Date.IsZero()
+			}
+			return one.Date.Before(two.Date)
+		case "ahead":
+			return ahead(one) > ahead(two)
+		case "author":
+			return one.Author < two.Author
+		}
+		return one.Name < two.Name
+	})
+	return indexes
+}
+
+func ahead(item SelectItem) int {
+	if item.Counts == nil {
+		return -1
+	}
+	return item.Counts.Ahead
+}
+
+// HandleKey updates the selector for a key returned by ParseKeys()
+func (s *Selector) HandleKey(key string) {
+	s.message = ""
+	if key == "ctrl-c" {
+		s.cancelled = true
+		return
+	}
+
+	switch s.mode {
+	case selectFilter:
+		s.filter = editLine(s.filter, key)
+		s.cursor = 0
+		if key == "enter" || key == "esc" {
+			s.mode = selectList
+		}
+	case selectPattern:
+		switch key {
+		case "enter":
+			s.selectPattern()
+			s.mode = selectList
+		case "esc":
+			s.mode = selectList
+		default:
+			s.pattern = editLine(s.pattern, key)
+		}
+	case selectConfirm:
+		switch key {
+		case "y", "Y":
+			s.done = true
+		case "n", "N", "esc", "q":
+			s.mode = selectList
+		}
+	default:
+		s.handleListKey(key)
+	}
+}
+
+func (s *Selector) handleListKey(key string) {
+	visible := s.visible()
+	switch key {
+	case "up", "k":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case "down", "j":
+		if s.cursor < len(visible)-1 {
+			s.cursor++
+		}
+	case "g":
+		s.cursor = 0
+	case "G":
+		if len(visible) != 0 {
+			s.cursor = len(visible) - 1
+		}
+	case "space":
+		if s.cursor < len(visible) {
+			item := &s.Items[visible[s.cursor]]
+			item.Selected = !item.Selected
+		}
+	case "a":
+		// Select every visible item, or unselect them if they are all selected
+		all := true
+		for _, idx := range visible {
+			all = all && s.Items[idx].Selected
+		}
+		for _, idx := range visible {
+			s.Items[idx].Selected = !all
+		}
+	case "/":
+		s.mode = selectFilter
+	case "*":
+		s.pattern = ""
+		s.mode = selectPattern
+	case "s":
+		s.sort = (s.sort + 1) % len(selectSorts)
+	case "enter":
+		if len(s.Selected()) == 0 {
+			s.message = "Nothing selected, use space to select branches"
+			return
+		}
+		s.mode = selectConfirm
+	case "q", "esc":
+		s.cancelled = true
+	}
+}
+
+// selectPattern selects every visible item matching the pattern, see CompilePattern()
+func (s *Selector) selectPattern() {
+	regex, err := CompilePattern(s.pattern)
+	if err != nil {
+		s.message = fmt.Sprintf("invalid pattern '%s': %s", s.pattern, err)
+		return
+	}
+	var count int
+	for _, idx := range s.visible() {
+		if regex.MatchString(s.Items[idx].Name) {
+			s.Items[idx].Selected = true
+			count++
+		}
+	}
+	s.message = fmt.Sprintf("Selected %d branches matching '%s'", count, s.pattern)
+}
+
+// editLine applies a key typed while editing 'line'
+func editLine(line, key string) string {
+	switch {
+	case key == "backspace":
+		if runes := []rune(line); len(runes) != 0 {
+			return string(runes[:len(runes)-1])
+		}
+	case key == "space":
+		return line + " "
+	case len([]rune(key)) == 1:
+		return line + key
+	}
+	return line
+}
+
+// Render draws the selector as lines no wider than 'width' filling 'height' rows
+func (s *Selector) Render(width, height int) []string {
+	if s.mode == selectConfirm {
+		return s.renderConfirm(width, height)
+	}
+
+	lines := []string{truncate(s.Title, width), ""}
+	visible := s.visible()
+
+	nameWidth := len("BRANCH")
+	for _, idx := range visible {
+		if len(s.Items[idx].Name) > nameWidth {
+			nameWidth = len(s.Items[idx].Name)
+		}
+	}
+	columns := "%-" + strconv.Itoa(nameWidth) + "s  %6s %6s  %4s  %s"
+	row := "%s [%s] " + columns
+	header := fmt.Sprintf("      "+columns, "BRANCH", "AHEAD", "BEHIND", "AGE", "AUTHOR")
+	lines = append(lines, truncate(header, width))
+
+	// Keep the cursor on screen, leaving room for the title, header and footer
+	rows := height - 5
+	if rows < 1 {
+		rows = 1
+	}
+	if s.cursor < s.offset {
+		s.offset = s.cursor
+	}
+	if s.cursor >= s.offset+rows {
+		s.offset = s.cursor - rows + 1
+	}
+
+	for pos := s.offset; pos < len(visible) && pos < s.offset+rows; pos++ {
+		item := s.Items[visible[pos]]
+		cursor, check := " ", " "
+		if pos == s.cursor {
+			cursor = ">"
+		}
+		if item.Selected {
+			check = "x"
+		}
+		aheadCount, behindCount, age := "-", "-", "-"
+		if item.Counts != nil {
+			aheadCount = strconv.Itoa(item.Counts.Ahead)
+			behindCount = strconv.Itoa(item.Counts.Behind)
+		}
+		if !item.Date.IsZero() {
+			age = FormatAge(s.Now.Sub(item.Date))
+		}
+		lines = append(lines, truncate(fmt.Sprintf(row, cursor, check, item.Name,
+			aheadCount, behindCount, age, item.Author), width))
+	}
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+
+	status := fmt.Sprintf("%d of %d selected, sorted by %s", len(s.Selected()), len(s.Items),
+		selectSorts[s.sort])
+	if s.filter != "" {
+		status += fmt.Sprintf(", filter '%s'", s.filter)
+	}
+	if s.message != "" {
+		status = s.message
+	}
+	lines = append(lines, truncate(status, width))
+
+	switch s.mode {
+	case selectFilter:
+		lines = append(lines, truncate("Filter: "+s.filter+"_", width))
+	case selectPattern:
+		lines = append(lines, truncate("Select pattern: "+s.pattern+"_", width))
+	default:
+		lines = append(lines, truncate("space toggle  a all  / filter  * select pattern  "+
+			"s sort  enter confirm  q quit", width))
+	}
+	return lines
+}
+
+func (s *Selector) renderConfirm(width, height int) []string {
+	selected := s.Selected()
+	lines := []string{truncate(fmt.Sprintf("%s: delete these %d branches?", s.Title, len(selected)), width), ""}
+	for idx, item := range selected {
+		// Leave room for the footer
+		if len(lines) >= height-3 && idx < len(selected)-1 {
+			lines = append(lines, fmt.Sprintf("  .. and %d more", len(selected)-idx))
+			break
+		}
+		lines = append(lines, truncate("  "+item.Name, width))
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	return append(lines, truncate("y delete  n go back", width))
+}
+
+func truncate(line string, width int) string {
+	if runes := []rune(line); width > 0 && len(runes) > width {
+		return string(runes[:width])
+	}
+	return line
+}
+
+// ParseKeys splits terminal input read in raw mode into key names. Printable characters are
+// returned as themselves, other keys as `up`, `down`, `enter`, `space`, `backspace`, `esc`
+// and `ctrl-c`. Unknown escape sequences are dropped.
+func ParseKeys(input []byte) []string {
+	var keys []string
+	for len(input) != 0 {
+		switch {
+		case input[0] == 0x1b && len(input) >= 3 && (input[1] == '[' || input[1] == 'O'):
+			switch input[2] {
+			case 'A':
+				keys = append(keys, "up")
+			case 'B':
+				keys = append(keys, "down")
+			}
+			// Skip the parameters and final byte of the sequence
+			end := 2
+			for end < len(input) && (input[end] < 0x40 || input[end] > 0x7e) {
+				end++
+			}
+			input = input[minInt(end+1, len(input)):]
+			continue
+		case input[0] == 0x1b:
+			keys = append(keys, "esc")
+		case input[0] == '\r' || input[0] == '\n':
+			keys = append(keys, "enter")
+		case input[0] == ' ':
+			keys = append(keys, "space")
+		case input[0] == 0x7f || input[0] == 0x08:
+			keys = append(keys, "backspace")
+		case input[0] == 0x03:
+			keys = append(keys, "ctrl-c")
+		case input[0] < 0x20:
+			// Ignore other control characters
+		default:
+			r := []rune(string(input))[0]
+			keys = append(keys, string(r))
+			input = input[len(string(r)):]
+			continue
+		}
+		input = input[1:]
+	}
+	return keys
+}
+
+func minInt(one, two int) int {
+	if one < two {
+		return one
+	}
+	return two
+}
+
+// Select shows a full screen list of 'items' on the terminal and returns the items the user
+// selected and confirmed, or nothing if they quit. ErrNoTerminal is returned if stdout is
+// not a terminal or the terminal can't be put in raw mode with `stty`.
+func Select(title string, items []SelectItem) ([]SelectItem, error) {
+	if !isTerminal(os.Stdout) {
+		return nil, ErrNoTerminal
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, ErrNoTerminal
+	}
+	defer tty.Close()
+
+	saved, err := stty(tty, "-g")
+	if err != nil {
+		return nil, ErrNoTerminal
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return nil, ErrNoTerminal
+	}
+	defer stty(tty, strings.TrimSpace(saved))
+
+	// Draw on the alternate screen with the cursor hidden so the scroll back is left alone
+	fmt.Fprint(tty, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(tty, "\x1b[?25h\x1b[?1049l")
+
+	selector := NewSelector(title, items)
+	buf := make([]byte, 64)
+	for !selector.Done() && !selector.Cancelled() {
+		width, height := terminalSize(tty)
+		fmt.Fprint(tty, "\x1b[H\x1b[2J"+strings.Join(selector.Render(width, height), "\r\n"))
+
+		count, err := tty.Read(buf)
+		if err != nil {
+			return nil, errors.Wrap(err, "while reading the terminal")
+		}
+		for _, key := range ParseKeys(buf[:count]) {
+			selector.HandleKey(key)
+		}
+	}
+	if selector.Cancelled() {
+		return nil, nil
+	}
+	return selector.Selected(), nil
+}
+
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// stty runs `stty` on the terminal 'tty' returning its output
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	output, err := cmd.Output()
+	return string(output), err
+}
+
+// terminalSize returns the width and height of 'tty' defaulting to 80x24
+func terminalSize(tty *os.File) (int, int) {
+	output, err := stty(tty, "size")
+	if err != nil {
+		return 80, 24
+	}
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return 80, 24
+	}
+	height, err1 := strconv.Atoi(fields[0])
+	width, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil || width == 0 || height == 0 {
+		return 80, 24
+	}
+	return width, height
+}
@@ -0,0 +1,125 @@
+package clip_test
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var _ = Describe("Selector", func() {
+	var selector *clip.Selector
+	now := time.Date(2018, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	press := func(keys ...string) {
+		for _, key := range keys {
+			selector.HandleKey(key)
+		}
+	}
+
+	selected := func() []string {
+		var names []string
+		for _, item := range selector.Selected() {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		selector = clip.NewSelector("Delete branches", []clip.SelectItem{
+			{Name: "release/1.0", Date: now.AddDate(-2, 0, 0), Author: "Clip",
+				Counts: &clip.AheadBehind{Ahead: 1, Behind: 30}},
+			{Name: "feature/one", Date: now.AddDate(0, 0, -3), Author: "Other",
+				Counts: &clip.AheadBehind{Ahead: 5}},
+			{Name: "feature/two", Author: "Clip"},
+		})
+		selector.Now = now
+	})
+
+	It("Should toggle the branch under the cursor", func() {
+		// Sorted by name
+		press("space", "down", "down", "space", "up", "space", "space")
+		Expect(selected()).To(Equal([]string{"release/1.0", "feature/one"}))
+	})
+
+	It("Should sort by age with unknown ages last", func() {
+		press("s", "space")
+		Expect(selected()).To(Equal([]string{"release/1.0"}))
+		press("G", "space")
+		Expect(selected()).To(Equal([]string{"release/1.0", "feature/two"}))
+	})
+
+	It("Should filter as you type and select all visible", func() {
+		press("/", "f", "e", "a", "x", "backspace", "enter", "a")
+		Expect(selected()).To(Equal([]string{"feature/one", "feature/two"}))
+		// Unselects when all visible are selected
+		press("a")
+		Expect(selected()).To(BeEmpty())
+	})
+
+	It("Should select by pattern", func() {
+		press("*", "r", "e", "l", "*", "enter")
+		Expect(selected()).To(Equal([]string{"release/1.0"}))
+		lines := selector.Render(80, 10)
+		Expect(lines[len(lines)-2]).To(Equal("Selected 1 branches matching 'rel*'"))
+	})
+
+	It("Should select by pattern only the branches the filter shows", func() {
+		press("/", "t", "w", "o", "enter", "*", "*", "enter")
+		Expect(selected()).To(Equal([]string{"feature/two"}))
+	})
+
+	It("Should confirm before finishing", func() {
+		press("enter")
+		Expect(selector.Render(80, 10)[8]).To(Equal("Nothing selected, use space to select branches"))
+
+		press("space", "enter")
+		Expect(selector.Done()).To(Equal(false))
+		Expect(selector.Render(80, 10)[0]).To(Equal("Delete branches: delete these 1 branches?"))
+		press("n", "enter", "y")
+		Expect(selector.Done()).To(Equal(true))
+		Expect(selected()).To(Equal([]string{"feature/one"}))
+	})
+
+	It("Should cancel on q or ctrl-c", func() {
+		press("space", "q")
+		Expect(selector.Cancelled()).To(Equal(true))
+	})
+
+	It("Should render columns and scroll to the cursor", func() {
+		lines := selector.Render(80, 10)
+		Expect(len(lines)).To(Equal(10))
+		Expect(strings.TrimRight(lines[2], " ")).To(Equal("      BRANCH        AHEAD BEHIND   AGE  AUTHOR"))
+		Expect(lines[3]).To(Equal("> [ ] feature/one       5      0    3d  Other"))
+		Expect(lines[4]).To(Equal("  [ ] feature/two       -      -     -  Clip"))
+		Expect(lines[5]).To(Equal("  [ ] release/1.0       1     30    2y  Clip"))
+
+		// Only one row fits so the cursor row is drawn
+		press("down", "down")
+		lines = selector.Render(20, 6)
+		Expect(lines[3]).To(Equal("> [ ] release/1.0   "))
+		Expect(len(lines)).To(Equal(6))
+		Expect(lines[4]).To(Equal("0 of 3 selected, sor"))
+	})
+})
+
+var _ = Describe("ParseKeys()", func() {
+	It("Should name special keys", func() {
+		keys := clip.ParseKeys([]byte("\x1b[A\x1b[Bj \r\x7f\x03\x1b\x1b[5~é"))
+		Expect(keys).To(Equal([]string{"up", "down", "j", "space", "enter", "backspace",
+			"ctrl-c", "esc", "é"}))
+	})
+})
+
+var _ = Describe("FormatAge()", func() {
+	It("Should use the largest whole unit", func() {
+		day := 24 * time.Hour
+		Expect(clip.FormatAge(400 * day)).To(Equal("1y"))
+		Expect(clip.FormatAge(20 * day)).To(Equal("2w"))
+		Expect(clip.FormatAge(3 * day)).To(Equal("3d"))
+		Expect(clip.FormatAge(5 * time.Hour)).To(Equal("5h"))
+		Expect(clip.FormatAge(90 * time.Second)).To(Equal("1m"))
+	})
+})
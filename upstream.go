@@ -0,0 +1,60 @@
+package clip
+
+// The state of the upstream a branch tracks
+const (
+	// UpstreamOK means the upstream branch exists
+	UpstreamOK = "ok"
+	// UpstreamGone means the upstream branch was deleted, usually after it was merged
+	UpstreamGone = "gone"
+	// UpstreamRemoteMissing means the remote the branch tracks is not configured
+	UpstreamRemoteMissing = "remote-missing"
+	// UpstreamMisconfigured means only one of `branch.<name>.remote` and `.merge` is set
+	UpstreamMisconfigured = "misconfigured"
+)
+
+// ListRemotes returns the names of the remotes configured with `remote.<name>.url`
+func (r *Repository) ListRemotes() (map[string]bool, error) {
+	config := Config{}
+	if err := r.Backend.ListConfig(config, `^remote\..*\.url$`); err != nil {
+		return nil, err
+	}
+	remotes := map[string]bool{}
+	for key := range config {
+		section, name, variable := splitConfigKey(key)
+		if section == "remote" && name != "" && variable == "url" {
+			remotes[name] = true
+		}
+	}
+	return remotes, nil
+}
+
+// UpstreamState returns the state of the upstream 'tracked' names, one of the Upstream
+// constants, or an empty string if 'tracked' is nil. 'remotes' are the configured remotes
+// as returned by Repository.ListRemotes().
+func UpstreamState(tracked *TrackedBranch, refs BranchReferenceMap, remotes map[string]bool) string {
+	if tracked == nil {
+		return ""
+	}
+	if tracked.Remote == "" || tracked.Merge == "" {
+		return UpstreamMisconfigured
+	}
+	name, err := GetRemoteBranchName(tracked.Merge)
+	if err != nil {
+		return UpstreamMisconfigured
+	}
+
+	// Branches may track another local branch
+	if tracked.Remote == "." {
+		if _, ok := refs["local"][name]; ok {
+			return UpstreamOK
+		}
+		return UpstreamGone
+	}
+	if !remotes[tracked.Remote] {
+		return UpstreamRemoteMissing
+	}
+	if _, ok := refs[tracked.Remote][name]; ok {
+		return UpstreamOK
+	}
+	return UpstreamGone
+}
@@ -0,0 +1,221 @@
+package clip
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Manifest lists the repositories of a workspace explicitly instead of discovering them
+type Manifest struct {
+	// Repos are the paths of the repositories relative to the manifest
+	Repos []string `yaml:"repos"`
+}
+
+// ReadManifest reads the manifest at 'path' and returns the paths of its repositories
+func ReadManifest(path string) ([]string, error) {
+	var manifest Manifest
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadManifest()")
+	}
+	if err := yaml.UnmarshalStrict(content, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "while parsing '%s'", path)
+	}
+
+	var paths []string
+	for _, repo := range manifest.Repos {
+		if !filepath.IsAbs(repo) {
+			repo = filepath.Join(filepath.Dir(path), repo)
+		}
+		paths = append(paths, filepath.Clean(repo))
+	}
+	return paths, nil
+}
+
+// FindRepositories returns the work trees of the git repositories under 'root' sorted by
+// path. Repositories nested inside another repository and hidden directories are skipped.
+// Directories that can't be read are skipped and returned as 'skipped' errors, only an
+// unreadable 'root' is an error.
+func FindRepositories(root string) (paths []string, skipped []error, err error) {
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			skipped = append(skipped, err)
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		// Worktrees and submodules have a `.git` file instead of a directory
+		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+			paths = append(paths, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "FindRepositories()")
+	}
+	return paths, skipped, nil
+}
+
+// WorkspaceRepo summarizes the branches of a single repository in a workspace
+type WorkspaceRepo struct {
+	Path  string
+	Trunk string
+	// Unpushed are branches with commits that are not in the trunk or any remote branch
+	Unpushed []string
+	// Behind are unmerged branches missing commits from the trunk
+	Behind []BranchCount
+	// Prunable are branches clip-local would delete, merged into the trunk and not checked
+	// out in a worktree
+	Prunable []string
+	// Failed are the branches that could not be analyzed, the rest are still summarized
+	Failed []BranchError
+	// Err is set if the repository could not be analyzed
+	Err error
+}
+
+// BranchCount is the number of commits a branch is behind the trunk
+type BranchCount struct {
+	Name   string
+	Behind int
+}
+
+// BranchError is the reason a branch could not be analyzed
+type BranchError struct {
+	Name string
+	Err  error
+}
+
+// WorkspaceOpts configures ScanWorkspace()
+type WorkspaceOpts struct {
+	// Workers is the number of repositories analyzed at once, defaults to the number of CPUs
+	Workers int
+	// OnResult if set is called with each repository as soon as it's analyzed, never at the
+	// same time
+	OnResult func(repo *WorkspaceRepo)
+}
+
+// ScanWorkspace analyzes the repositories at 'paths' concurrently and returns a summary of
+// each in the same order. A repository that fails to analyze has its Err set. If 'ctx' is
+// cancelled the repositories not yet started have their Err set to the context error.
+func ScanWorkspace(ctx context.Context, paths []string, opts WorkspaceOpts) []*WorkspaceRepo {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	results := make([]*WorkspaceRepo, len(paths))
+	var mutex sync.Mutex
+	finish := func(idx int, result *WorkspaceRepo) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results[idx] = result
+		if opts.OnResult != nil {
+			opts.OnResult(result)
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				finish(idx, ScanRepository(ctx, paths[idx]))
+			}
+		}()
+	}
+
+	for idx, path := range paths {
+		select {
+		case jobs <- idx:
+			continue
+		case <-ctx.Done():
+		}
+		finish(idx, &WorkspaceRepo{Path: path, Err: ctx.Err()})
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// ScanRepository analyzes the repository at 'path' and summarizes its branches, branches
+// that fail to analyze are listed in Failed. $GIT_DIR is ignored, see NewNativeBackendAt().
+func ScanRepository(ctx context.Context, path string) *WorkspaceRepo {
+	result := &WorkspaceRepo{Path: path}
+	backend, err := NewNativeBackendAt(path)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	repo := NewRepository(backend)
+
+	current, err := repo.CurrentBranch()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	policy, err := repo.LoadPolicy()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	// The repositories are analyzed concurrently so each analyzes one branch at a time
+	report, err := repo.Analyze(ctx, AnalyzeOpts{Workers: 1})
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.Trunk = report.Trunk.Name
+	for _, branch := range report.Branches {
+		if branch == report.Trunk {
+			continue
+		}
+		if branch.Err != nil {
+			result.Failed = append(result.Failed, BranchError{Name: branch.Name, Err: branch.Err})
+			continue
+		}
+		if branch.Merged == "" && !onRemote(branch) {
+			result.Unpushed = append(result.Unpushed, branch.Name)
+		}
+		if branch.Merged == "" && branch.Trunk.Behind != 0 {
+			result.Behind = append(result.Behind, BranchCount{Name: branch.Name, Behind: branch.Trunk.Behind})
+		}
+		// The same branches clip-local deletes without --include-unmerged
+		if branch.Merged != "" && branch.Name != current && branch.Worktree == nil &&
+			policy.Protected(branch.Name) == nil {
+			result.Prunable = append(result.Prunable, branch.Name)
+		}
+	}
+	return result
+}
+
+// onRemote returns true if a remote branch has every commit of 'branch'
+func onRemote(branch *BranchDetail) bool {
+	for _, remote := range branch.Remotes {
+		if remote != nil && branch.RemoteCounts[remote.Ref].Ahead == 0 {
+			return true
+		}
+	}
+	return false
+}
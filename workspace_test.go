@@ -0,0 +1,151 @@
+package clip_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+// newWorkspaceRepo creates a repository with an unpushed, a behind and a merged branch
+func newWorkspaceRepo(root string) {
+	Expect(os.MkdirAll(root, 0755)).To(Succeed())
+	git(root, "init", "-q", "-b", "main")
+	git(root, "commit", "-q", "--allow-empty", "-m", "init")
+	git(root, "branch", "done")
+	for _, name := range []string{"wip", "old"} {
+		git(root, "checkout", "-q", "-b", name, "main")
+		writeFile(filepath.Join(root, name+".txt"), name+"\n")
+		git(root, "add", ".")
+		git(root, "commit", "-q", "-m", name)
+	}
+	git(root, "update-ref", "refs/remotes/origin/old", "old")
+	git(root, "checkout", "-q", "main")
+	git(root, "commit", "-q", "--allow-empty", "-m", "next")
+}
+
+var _ = Describe("Workspace", func() {
+	var root string
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-workspace")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Should find repositories skipping nested and hidden ones", func() {
+		writeFile(filepath.Join(root, "svc/api/.git/HEAD"), "ref: refs/heads/main\n")
+		writeFile(filepath.Join(root, "svc/api/vendor/lib/.git/HEAD"), "ref: refs/heads/main\n")
+		writeFile(filepath.Join(root, "svc/web/.git"), "gitdir: ../../.worktrees/web\n")
+		writeFile(filepath.Join(root, ".cache/tool/.git/HEAD"), "ref: refs/heads/main\n")
+		writeFile(filepath.Join(root, "docs/README.md"), "docs\n")
+
+		paths, skipped, err := clip.FindRepositories(root)
+		Expect(err).To(BeNil())
+		Expect(skipped).To(BeEmpty())
+		Expect(paths).To(Equal([]string{
+			filepath.Join(root, "svc/api"),
+			filepath.Join(root, "svc/web"),
+		}))
+	})
+
+	It("Should skip directories it can't read", func() {
+		if os.Geteuid() == 0 {
+			Skip("root can read every directory")
+		}
+		writeFile(filepath.Join(root, "api/.git/HEAD"), "ref: refs/heads/main\n")
+		writeFile(filepath.Join(root, "locked/web/.git/HEAD"), "ref: refs/heads/main\n")
+		Expect(os.Chmod(filepath.Join(root, "locked"), 0)).To(Succeed())
+		defer os.Chmod(filepath.Join(root, "locked"), 0755)
+
+		paths, skipped, err := clip.FindRepositories(root)
+		Expect(err).To(BeNil())
+		Expect(paths).To(Equal([]string{filepath.Join(root, "api")}))
+		Expect(len(skipped)).To(Equal(1))
+	})
+
+	It("Should read repositories relative to the manifest", func() {
+		path := filepath.Join(root, "team/manifest.yml")
+		writeFile(path, "repos:\n  - api\n  - ../web\n  - /src/lib\n")
+		paths, err := clip.ReadManifest(path)
+		Expect(err).To(BeNil())
+		Expect(paths).To(Equal([]string{
+			filepath.Join(root, "team/api"),
+			filepath.Join(root, "web"),
+			"/src/lib",
+		}))
+
+		writeFile(path, "repo:\n  - api\n")
+		_, err = clip.ReadManifest(path)
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Should summarize the branches of each repository", func() {
+		api := filepath.Join(root, "api")
+		newWorkspaceRepo(api)
+		missing := filepath.Join(root, "missing")
+
+		var finished []string
+		repos := clip.ScanWorkspace(context.Background(), []string{api, missing}, clip.WorkspaceOpts{
+			OnResult: func(repo *clip.WorkspaceRepo) {
+				finished = append(finished, repo.Path)
+			},
+		})
+		Expect(finished).To(ConsistOf(api, missing))
+		Expect(len(repos)).To(Equal(2))
+
+		Expect(repos[0].Err).To(BeNil())
+		Expect(repos[0].Trunk).To(Equal("main"))
+		Expect(repos[0].Unpushed).To(Equal([]string{"wip"}))
+		Expect(repos[0].Behind).To(Equal([]clip.BranchCount{{Name: "old", Behind: 1}, {Name: "wip", Behind: 1}}))
+		Expect(repos[0].Prunable).To(Equal([]string{"done"}))
+		Expect(repos[0].Failed).To(BeEmpty())
+
+		Expect(repos[1].Path).To(Equal(missing))
+		Expect(repos[1].Err).NotTo(BeNil())
+	})
+
+	It("Should scan each repository and not the one in $GIT_DIR", func() {
+		api, other := filepath.Join(root, "api"), filepath.Join(root, "other")
+		newWorkspaceRepo(api)
+		Expect(os.MkdirAll(other, 0755)).To(Succeed())
+		git(other, "init", "-q", "-b", "trunk")
+		git(other, "commit", "-q", "--allow-empty", "-m", "init")
+		os.Setenv("GIT_DIR", filepath.Join(other, ".git"))
+		defer os.Unsetenv("GIT_DIR")
+
+		repos := clip.ScanWorkspace(context.Background(), []string{api}, clip.WorkspaceOpts{})
+		Expect(repos[0].Err).To(BeNil())
+		Expect(repos[0].Trunk).To(Equal("main"))
+		Expect(repos[0].Unpushed).To(Equal([]string{"wip"}))
+	})
+
+	It("Should summarize the other branches when a branch fails", func() {
+		api := filepath.Join(root, "api")
+		newWorkspaceRepo(api)
+		// A branch whose tree is missing
+		git(api, "checkout", "-q", "-b", "broken", "main")
+		writeFile(filepath.Join(api, "broken.txt"), "broken\n")
+		git(api, "add", ".")
+		git(api, "commit", "-q", "-m", "broken")
+		git(api, "checkout", "-q", "main")
+		tree := strings.TrimSpace(git(api, "rev-parse", "broken^{tree}"))
+		Expect(os.Remove(filepath.Join(api, ".git/objects", tree[:2], tree[2:]))).To(Succeed())
+
+		repos := clip.ScanWorkspace(context.Background(), []string{api}, clip.WorkspaceOpts{})
+		Expect(repos[0].Err).To(BeNil())
+		Expect(len(repos[0].Failed)).To(Equal(1))
+		Expect(repos[0].Failed[0].Name).To(Equal("broken"))
+		Expect(repos[0].Unpushed).To(Equal([]string{"wip"}))
+		Expect(repos[0].Prunable).To(Equal([]string{"done"}))
+	})
+})
@@ -0,0 +1,184 @@
+package clip
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Worktree is a working tree of the repository as listed by `git worktree list`
+type Worktree struct {
+	Path string
+	// Head is the sha checked out in the worktree
+	Head string
+	// Branch is the name of the branch checked out or empty if HEAD is detached
+	Branch string
+	Bare   bool
+	// Dirty is true if the worktree has uncommitted or untracked changes
+	Dirty bool
+	// Status counts the changes in the worktree
+	Status StatusCounts
+	// StatusErr is set if the changes could not be counted, Dirty and Status are unknown
+	StatusErr error
+	// Prunable is true if the worktree directory no longer exists
+	Prunable bool
+	// Current is true for the worktree clip is run from
+	Current bool
+}
+
+// StatusCounts is the number of files with changes in a worktree
+type StatusCounts struct {
+	// Staged are changes in the index
+	Staged int
+	// Unstaged are changes to tracked files not in the index, including unmerged files
+	Unstaged  int
+	Untracked int
+}
+
+// ParseStatus counts the changes listed by `git status --porcelain`
+func ParseStatus(output string) StatusCounts {
+	var counts StatusCounts
+	for _, line := range strings.Split(output, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		switch {
+		case line[:2] == "??":
+			counts.Untracked++
+		case line[0] == 'U' || line[1] == 'U' || line[:2] == "AA" || line[:2] == "DD":
+			counts.Unstaged++
+		default:
+			if line[0] != ' ' {
+				counts.Staged++
+			}
+			if line[1] != ' ' {
+				counts.Unstaged++
+			}
+		}
+	}
+	return counts
+}
+
+// ListWorktrees returns every worktree of the repository, the main worktree first. The
+// changes in each are not counted, see LoadWorktreeStatus().
+func (r *Repository) ListWorktrees() ([]*Worktree, error) {
+	var worktrees []*Worktree
+	if err := r.Backend.ListWorktrees(&worktrees); err != nil {
+		return nil, err
+	}
+	current, err := r.Backend.WorkTree()
+	if err != nil {
+		return nil, err
+	}
+	for _, worktree := range worktrees {
+		worktree.Current = current != "" && samePath(worktree.Path, current)
+	}
+	return worktrees, nil
+}
+
+// LoadWorktreeStatus counts the changes in each of 'worktrees', a worktree whose changes
+// can't be counted has its StatusErr set
+func (r *Repository) LoadWorktreeStatus(worktrees []*Worktree) {
+	for _, worktree := range worktrees {
+		if worktree.Bare || worktree.Prunable {
+			continue
+		}
+		status, err := r.Backend.WorktreeStatus(worktree.Path)
+		if err != nil {
+			worktree.StatusErr = err
+			continue
+		}
+		worktree.Status = status
+		worktree.Dirty = status != StatusCounts{}
+	}
+}
+
+// CurrentWorktree returns the worktree clip is run from or nil in a bare repository
+func CurrentWorktree(worktrees []*Worktree) *Worktree {
+	for _, worktree := range worktrees {
+		if worktree.Current {
+			return worktree
+		}
+	}
+	return nil
+}
+
+// CheckedOut returns the worktree other than the current one that has 'branch' checked out
+// or nil if there is none
+func CheckedOut(worktrees []*Worktree, branch string) *Worktree {
+	for _, worktree := range worktrees {
+		if !worktree.Current && worktree.Branch == branch {
+			return worktree
+		}
+	}
+	return nil
+}
+
+// ParseWorktrees parses the output of `git worktree list --porcelain` into 'result'
+func ParseWorktrees(result *[]*Worktree, output string) error {
+	var worktree *Worktree
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			worktree = nil
+			continue
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if parts[0] == "worktree" {
+			if len(parts) != 2 {
+				return errors.Errorf("invalid worktree line '%s'", line)
+			}
+			worktree = &Worktree{Path: parts[1]}
+			*result = append(*result, worktree)
+			continue
+		}
+		if worktree == nil {
+			return errors.Errorf("expected a worktree line but got '%s'", line)
+		}
+		switch parts[0] {
+		case "HEAD":
+			if len(parts) == 2 {
+				worktree.Head = parts[1]
+			}
+		case "branch":
+			if len(parts) == 2 {
+				worktree.Branch = strings.TrimPrefix(parts[1], "refs/heads/")
+			}
+		case "bare":
+			worktree.Bare = true
+		case "prunable":
+			worktree.Prunable = true
+		}
+	}
+	return nil
+}
+
+// samePath returns true if 'one' and 'two' name the same directory once symlinks are
+// resolved, git reports the real path of worktrees
+func samePath(one, two string) bool {
+	if resolved, err := filepath.EvalSymlinks(one); err == nil {
+		one = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(two); err == nil {
+		two = resolved
+	}
+	return filepath.Clean(one) == filepath.Clean(two)
+}
+
+func (b *ExecBackend) ListWorktrees(result *[]*Worktree) error {
+	var output string
+	if err := b.git(&output, "worktree", "list", "--porcelain"); err != nil {
+		return errors.Wrap(err, "ListWorktrees()")
+	}
+	return ParseWorktrees(result, output)
+}
+
+func (b *ExecBackend) WorktreeStatus(path string) (StatusCounts, error) {
+	var output string
+	// Don't refresh the index of a worktree someone may be working in
+	status := NewExecBackend(path)
+	if err := status.git(&output, "--no-optional-locks", "status", "--porcelain"); err != nil {
+		return StatusCounts{}, errors.Wrapf(err, "while checking worktree '%s'", path)
+	}
+	return ParseStatus(output), nil
+}
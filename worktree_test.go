@@ -0,0 +1,122 @@
+package clip_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/thrawn01/clip"
+)
+
+var worktreeList = `worktree /src/clip
+HEAD ` + shaMaster + `
+branch refs/heads/master
+
+worktree /src/clip-fix
+HEAD ` + shaFix + `
+branch refs/heads/fix-me-local
+locked
+
+worktree /src/clip-detached
+HEAD ` + shaTag + `
+detached
+prunable gitdir file points to non-existent location
+
+`
+
+var _ = Describe("ParseWorktrees()", func() {
+	It("Should parse each worktree", func() {
+		var worktrees []*clip.Worktree
+		Expect(clip.ParseWorktrees(&worktrees, worktreeList)).To(Succeed())
+		Expect(worktrees).To(Equal([]*clip.Worktree{
+			{Path: "/src/clip", Head: shaMaster, Branch: "master"},
+			{Path: "/src/clip-fix", Head: shaFix, Branch: "fix-me-local"},
+			{Path: "/src/clip-detached", Head: shaTag, Prunable: true},
+		}))
+	})
+})
+
+var _ = Describe("Worktrees", func() {
+	var root, linked string
+	var repo *clip.Repository
+
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "clip-worktree")
+		Expect(err).To(BeNil())
+		// Git reports the real path of worktrees
+		root, err = filepath.EvalSymlinks(root)
+		Expect(err).To(BeNil())
+
+		main := filepath.Join(root, "main")
+		linked = filepath.Join(root, "linked")
+		Expect(os.MkdirAll(main, 0755)).To(Succeed())
+		git(main, "init", "-q", "-b", "main")
+		writeFile(filepath.Join(main, "README"), "clip\n")
+		git(main, "add", ".")
+		git(main, "commit", "-q", "-m", "init")
+		git(main, "branch", "other")
+		// Stash a change to the main branch
+		writeFile(filepath.Join(main, "README"), "stashed\n")
+		git(main, "stash", "-q")
+		git(main, "worktree", "add", "-q", linked, "-b", "feature")
+		writeFile(filepath.Join(linked, "wip.txt"), "wip\n")
+
+		backend, err := clip.NewNativeBackend(main)
+		Expect(err).To(BeNil())
+		repo = clip.NewRepository(backend)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("Should record the worktree of each branch", func() {
+		report, err := repo.Analyze(context.Background(), clip.AnalyzeOpts{})
+		Expect(err).To(BeNil())
+
+		details := map[string]*clip.BranchDetail{}
+		for _, branch := range report.Branches {
+			details[branch.Name] = branch
+		}
+		Expect(details["main"].Worktree).NotTo(BeNil())
+		Expect(details["main"].Worktree.Current).To(Equal(true))
+		Expect(details["main"].Worktree.Dirty).To(Equal(false))
+		Expect(details["feature"].Worktree).NotTo(BeNil())
+		Expect(details["feature"].Worktree.Path).To(Equal(linked))
+		Expect(details["feature"].Worktree.Current).To(Equal(false))
+		Expect(details["feature"].Worktree.Dirty).To(Equal(true))
+		Expect(details["feature"].Worktree.Status).To(Equal(clip.StatusCounts{Untracked: 1}))
+		Expect(details["other"].Worktree).To(BeNil())
+
+		Expect(report.Head.Branch).To(Equal("main"))
+		Expect(len(details["main"].Stashes)).To(Equal(1))
+		Expect(details["main"].Stashes[0].Ref).To(Equal("stash@{0}"))
+		Expect(report.Stashes).To(BeEmpty())
+	})
+
+	It("Should record a worktree whose changes can't be counted", func() {
+		writeFile(filepath.Join(root, "main/.git/worktrees/linked/index"), "corrupt")
+		report, err := repo.Analyze(context.Background(), clip.AnalyzeOpts{})
+		Expect(err).To(BeNil())
+
+		for _, branch := range report.Branches {
+			if branch.Name == "feature" {
+				Expect(branch.Worktree.StatusErr).NotTo(BeNil())
+				Expect(branch.Worktree.Dirty).To(Equal(false))
+			}
+			if branch.Name == "main" {
+				Expect(branch.Worktree.StatusErr).To(BeNil())
+			}
+		}
+	})
+
+	It("Should refuse to delete branches checked out in another worktree", func() {
+		Expect(repo.DeleteLocalBranch("feature")).To(MatchError(
+			"refusing to delete 'feature'; it is checked out in worktree '" + linked + "'"))
+		Expect(repo.DeleteLocalBranch("other")).To(Succeed())
+	})
+})